@@ -1,17 +1,43 @@
 package board
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"time"
 )
 
+// ErrInvalidPin is returned, wrapped with the pin, for pins a board cannot
+// use as GPIO.
+var ErrInvalidPin = errors.New("invalid pin")
+
 type Board interface {
 	io.Closer
-	SetPinMode(pin int, mode PinMode)
+	SetPinMode(pin int, mode PinMode) error
 	DigitalRead(pin int) bool
 	DigitalWrite(pin int, v bool)
 	DigitalWrites([]PinValue)
 }
 
+// Memory maps physical memory blocks as 32 bits registers, for the boards
+// driving their GPIO registers directly.
+type Memory interface {
+	io.Closer
+	Map(offset int64, length int) ([]uint32, error)
+}
+
+// PinLister is implemented by boards knowing the pins they can use as GPIO.
+type PinLister interface {
+	// Pins returns the usable pins in increasing order.
+	Pins() []int
+}
+
+// Sleeper is implemented by boards keeping their own clock, like simulated
+// ones, for drivers timing pulses to wait on it rather than on the CPU.
+type Sleeper interface {
+	Sleep(d time.Duration)
+}
+
 type PinMode int
 
 const (
@@ -23,3 +49,45 @@ type PinValue struct {
 	Pin   int
 	Value bool
 }
+
+// CheckPin returns ErrInvalidPin, wrapped with the pin, if the pin is
+// negative or if b implements PinLister and does not list it.
+func CheckPin(b Board, pin int) error {
+	if pin < 0 {
+		return InvalidPinError(pin)
+	}
+	pl, ok := b.(PinLister)
+	if !ok {
+		return nil
+	}
+	for _, p := range pl.Pins() {
+		if p == pin {
+			return nil
+		}
+	}
+	return InvalidPinError(pin)
+}
+
+// InvalidPinError returns ErrInvalidPin wrapped with pin.
+func InvalidPinError(pin int) error {
+	return fmt.Errorf("pin %d: %w", pin, ErrInvalidPin)
+}
+
+// Pull is the internal pull resistor setting of a pin.
+type Pull int
+
+const (
+	PullNone = Pull(iota + 1)
+	PullUp
+	PullDown
+)
+
+// DriveStrength is the output current of a pin in milliamps.
+type DriveStrength int
+
+// PinConfigurer is implemented by boards able to configure the pull resistor
+// and the drive strength of their pins.
+type PinConfigurer interface {
+	SetPull(pin int, pull Pull) error
+	SetDriveStrength(pin int, ds DriveStrength) error
+}
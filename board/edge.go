@@ -0,0 +1,94 @@
+package board
+
+import (
+	"context"
+	"time"
+)
+
+// EdgePollInterval is the interval at which the pins are polled when
+// watching edges.
+const EdgePollInterval = time.Millisecond
+
+// Edge is a change of level of an input pin.
+type Edge int
+
+const (
+	RisingEdge = Edge(iota + 1)
+	FallingEdge
+	BothEdges
+)
+
+func (e Edge) matches(edge Edge) bool {
+	return e == BothEdges || e == edge
+}
+
+// EdgeEvent is an edge detected on a pin. Edge is either RisingEdge or
+// FallingEdge.
+type EdgeEvent struct {
+	Pin  int
+	Edge Edge
+	Time time.Time
+}
+
+// EdgeWatcher is implemented by boards detecting edges themselves.
+type EdgeWatcher interface {
+	WatchEdges(ctx context.Context, pin int, edge Edge, debounce time.Duration) (<-chan EdgeEvent, error)
+}
+
+// WatchEdges sets pin as input and sends its edges matching edge on the
+// returned channel until ctx is done, then closes it. A level change is only
+// reported once the level stayed the same during debounce, with the time it
+// was first seen. It uses b edge detection if it implements EdgeWatcher,
+// which may debounce differently, and polls DigitalRead every
+// EdgePollInterval otherwise.
+func WatchEdges(ctx context.Context, b Board, pin int, edge Edge, debounce time.Duration) (<-chan EdgeEvent, error) {
+	if ew, ok := b.(EdgeWatcher); ok {
+		return ew.WatchEdges(ctx, pin, edge, debounce)
+	}
+	if err := b.SetPinMode(pin, Input); err != nil {
+		return nil, err
+	}
+	c := make(chan EdgeEvent, 1)
+	go pollEdges(ctx, b, pin, b.DigitalRead(pin), edge, debounce, c)
+	return c, nil
+}
+
+func pollEdges(ctx context.Context, b Board, pin int, level bool, edge Edge, debounce time.Duration, c chan<- EdgeEvent) {
+	defer close(c)
+	t := time.NewTicker(EdgePollInterval)
+	defer t.Stop()
+	// changed is the time the level was first seen different from level.
+	var changed time.Time
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-t.C:
+		}
+		if b.DigitalRead(pin) == level {
+			changed = time.Time{}
+			continue
+		}
+		if changed.IsZero() {
+			changed = now
+		}
+		if now.Sub(changed) < debounce {
+			continue
+		}
+		level = !level
+		ev := EdgeEvent{Pin: pin, Edge: FallingEdge, Time: changed}
+		if level {
+			ev.Edge = RisingEdge
+		}
+		changed = time.Time{}
+		if !edge.matches(ev.Edge) {
+			continue
+		}
+		select {
+		case c <- ev:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
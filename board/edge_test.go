@@ -0,0 +1,73 @@
+package board_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/fake"
+)
+
+func TestWatchEdges(t *testing.T) {
+	tt := []struct {
+		name     string
+		edge     board.Edge
+		debounce time.Duration
+		want     []board.Edge
+	}{
+		{"Rising", board.RisingEdge, 0, []board.Edge{board.RisingEdge, board.RisingEdge}},
+		{"Falling", board.FallingEdge, 0, []board.Edge{board.FallingEdge}},
+		{"Both", board.BothEdges, 0, []board.Edge{board.RisingEdge, board.FallingEdge, board.RisingEdge}},
+		{"Debounced", board.BothEdges, 50 * time.Millisecond, []board.Edge{board.RisingEdge}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			const pin = 7
+			b := fake.New()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			c, err := board.WatchEdges(ctx, b, pin, tc.edge, tc.debounce)
+			if err != nil {
+				t.Fatalf("expect WatchEdges to return no error: %v", err)
+			}
+			if got, want := b.Mode(pin), board.Input; got != want {
+				t.Errorf("invalid pin mode: got %v; want %v", got, want)
+			}
+			done := make(chan []board.Edge)
+			go func() {
+				var edges []board.Edge
+				for ev := range c {
+					if ev.Pin != pin || ev.Time.IsZero() {
+						t.Errorf("invalid event: %+v", ev)
+					}
+					edges = append(edges, ev.Edge)
+				}
+				done <- edges
+			}()
+
+			// Short glitches are filtered out by the debounce duration.
+			hold := 10 * board.EdgePollInterval
+			if tc.debounce > 0 {
+				hold = tc.debounce / 10
+			}
+			for _, v := range []bool{true, false, true} {
+				b.SetInput(pin, v)
+				time.Sleep(hold)
+			}
+			time.Sleep(2*tc.debounce + hold)
+			cancel()
+
+			got := <-done
+			if len(got) != len(tc.want) {
+				t.Fatalf("invalid edges: got %v; want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("invalid edges: got %v; want %v", got, tc.want)
+					break
+				}
+			}
+		})
+	}
+}
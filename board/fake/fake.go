@@ -0,0 +1,160 @@
+// Package fake provides an in-memory board.Board recording every call made to
+// it, to test board drivers without any hardware.
+package fake
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/post-l/hw/board"
+)
+
+// Op is the kind of a recorded call.
+type Op int
+
+const (
+	SetPinMode = Op(iota + 1)
+	DigitalWrite
+	DigitalWrites
+)
+
+func (op Op) String() string {
+	switch op {
+	case SetPinMode:
+		return "SetPinMode"
+	case DigitalWrite:
+		return "DigitalWrite"
+	case DigitalWrites:
+		return "DigitalWrites"
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// Call is a recorded board call. Pin and Mode are set for SetPinMode, Values
+// for DigitalWrite and DigitalWrites. Time is the board clock at the call.
+type Call struct {
+	Seq    int
+	Time   time.Duration
+	Op     Op
+	Pin    int
+	Mode   board.PinMode
+	Values []board.PinValue
+}
+
+// Board is a board.Board keeping pin levels in memory and recording calls
+// with increasing sequence numbers. Its clock only advances on Sleep, calls
+// taking no time, so that traces do not depend on the host. It is safe for
+// concurrent use.
+type Board struct {
+	mu     sync.Mutex
+	seq    int
+	now    time.Duration
+	calls  Trace
+	modes  map[int]board.PinMode
+	levels map[int]bool
+	closed bool
+}
+
+// New returns a new fake Board with all pins low and unconfigured.
+func New() *Board {
+	return &Board{
+		modes:  make(map[int]board.PinMode),
+		levels: make(map[int]bool),
+	}
+}
+
+func (b *Board) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return nil
+}
+
+// SetPinMode records the call and sets the pin mode. It only rejects
+// negative pins.
+func (b *Board) SetPinMode(pin int, mode board.PinMode) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.record(Call{Op: SetPinMode, Pin: pin, Mode: mode})
+	if pin < 0 {
+		return board.InvalidPinError(pin)
+	}
+	b.modes[pin] = mode
+	return nil
+}
+
+func (b *Board) DigitalRead(pin int) bool {
+	b.mu.Lock()
+	v := b.levels[pin]
+	b.mu.Unlock()
+	return v
+}
+
+func (b *Board) DigitalWrite(pin int, v bool) {
+	b.mu.Lock()
+	b.levels[pin] = v
+	b.record(Call{Op: DigitalWrite, Values: []board.PinValue{{Pin: pin, Value: v}}})
+	b.mu.Unlock()
+}
+
+func (b *Board) DigitalWrites(pvs []board.PinValue) {
+	b.mu.Lock()
+	for _, pv := range pvs {
+		b.levels[pv.Pin] = pv.Value
+	}
+	b.record(Call{Op: DigitalWrites, Values: append([]board.PinValue(nil), pvs...)})
+	b.mu.Unlock()
+}
+
+// Sleep advances the board clock by d without waiting. It implements
+// board.Sleeper.
+func (b *Board) Sleep(d time.Duration) {
+	b.mu.Lock()
+	b.now += d
+	b.mu.Unlock()
+}
+
+// SetInput sets the level returned by DigitalRead for pin, as an external
+// signal would. It is not recorded.
+func (b *Board) SetInput(pin int, v bool) {
+	b.mu.Lock()
+	b.levels[pin] = v
+	b.mu.Unlock()
+}
+
+// Mode returns the last mode set for pin, 0 if none.
+func (b *Board) Mode(pin int) board.PinMode {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.modes[pin]
+}
+
+// Closed reports whether Close has been called.
+func (b *Board) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Trace returns a copy of the calls recorded so far.
+func (b *Board) Trace() Trace {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append(Trace(nil), b.calls...)
+}
+
+// Reset drops the recorded calls. Pin modes and levels are kept, and sequence
+// numbers keep increasing.
+func (b *Board) Reset() {
+	b.mu.Lock()
+	b.calls = nil
+	b.mu.Unlock()
+}
+
+func (b *Board) record(c Call) {
+	b.seq++
+	c.Seq = b.seq
+	c.Time = b.now
+	b.calls = append(b.calls, c)
+}
@@ -0,0 +1,77 @@
+package fake_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/fake"
+)
+
+func TestBoard(t *testing.T) {
+	b := fake.New()
+	b.SetPinMode(1, board.Output)
+	b.DigitalWrite(1, true)
+	b.DigitalWrites([]board.PinValue{{Pin: 1, Value: false}, {Pin: 2, Value: true}})
+	if got, want := b.Mode(1), board.Output; got != want {
+		t.Errorf("invalid pin mode: got %v; want %v", got, want)
+	}
+	if got, want := b.DigitalRead(2), true; got != want {
+		t.Errorf("invalid digital read value: got %v; want %v", got, want)
+	}
+	b.SetInput(3, true)
+	if got, want := b.DigitalRead(3), true; got != want {
+		t.Errorf("invalid digital read value: got %v; want %v", got, want)
+	}
+	tr := b.Trace()
+	var ops []fake.Op
+	for i, c := range tr {
+		if got, want := c.Seq, i+1; got != want {
+			t.Errorf("invalid call %d sequence: got %d; want %d", i, got, want)
+		}
+		ops = append(ops, c.Op)
+	}
+	if got, want := ops, []fake.Op{fake.SetPinMode, fake.DigitalWrite, fake.DigitalWrites}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid recorded ops: got %v; want %v", got, want)
+	}
+	b.Reset()
+	b.DigitalWrite(1, true)
+	if tr := b.Trace(); len(tr) != 1 || tr[0].Seq != 4 {
+		t.Errorf("invalid trace after reset: %+v", tr)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	const (
+		clk = 10
+		stb = 11
+		oe  = 12
+		d0  = 20
+		d1  = 21
+	)
+	b := fake.New()
+	b.DigitalWrite(oe, true)
+	b.DigitalWrites([]board.PinValue{{Pin: d0, Value: true}, {Pin: d1, Value: false}, {Pin: clk, Value: false}})
+	b.DigitalWrite(clk, true)
+	b.DigitalWrites([]board.PinValue{{Pin: d0, Value: false}, {Pin: d1, Value: true}, {Pin: clk, Value: false}})
+	b.DigitalWrite(clk, true)
+	b.DigitalWrite(clk, true)
+	b.DigitalWrite(stb, true)
+	b.DigitalWrite(stb, false)
+	b.DigitalWrite(oe, false)
+	b.Sleep(130 * time.Nanosecond)
+	b.DigitalWrite(oe, true)
+	b.DigitalWrite(oe, false)
+	tr := b.Trace()
+
+	if got, want := tr.Clocks(clk, []int{d0, d1}), []fake.Sample{{Seq: 3, Bits: 1}, {Seq: 5, Bits: 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid clocks: got %v; want %v", got, want)
+	}
+	if got, want := tr.Latches(stb, []int{d0, d1}), []fake.Sample{{Seq: 7, Bits: 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid latches: got %v; want %v", got, want)
+	}
+	if got, want := tr.Pulses(oe, false), []fake.Pulse{{Start: 9, End: 10, Duration: 130 * time.Nanosecond}, {Start: 11}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid pulses: got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package fake
+
+import "time"
+
+// Trace is a sequence of recorded calls.
+type Trace []Call
+
+// Sample is the value of a set of pins at a given call, the i-th bit being
+// the level of the i-th pin.
+type Sample struct {
+	Seq  int
+	Bits uint32
+}
+
+// Pulse is a period during which a pin was held at its active level. Start
+// is the call activating it and End the one releasing it, 0 if it was still
+// active at the end of the trace. Duration is the board time between them.
+type Pulse struct {
+	Start, End int
+	Duration   time.Duration
+}
+
+// Clocks returns the rising edges of the clock pin, the shift-register
+// clocks, with the data pins sampled at each edge.
+func (t Trace) Clocks(clock int, data []int) []Sample {
+	return t.risingEdges(clock, data)
+}
+
+// Latches returns the rising edges of the strobe pin with the address pins
+// sampled at each edge.
+func (t Trace) Latches(strobe int, addr []int) []Sample {
+	return t.risingEdges(strobe, addr)
+}
+
+// Pulses returns the periods during which pin was at the level active, like
+// the active low output enable of a LED matrix.
+func (t Trace) Pulses(pin int, active bool) []Pulse {
+	var ps []Pulse
+	var p *Pulse
+	var start time.Duration
+	t.replay(func(c Call, levels map[int]bool, prev bool) {
+		v := levels[pin]
+		switch {
+		case v == prev:
+		case v == active:
+			ps = append(ps, Pulse{Start: c.Seq})
+			p = &ps[len(ps)-1]
+			start = c.Time
+		case p != nil:
+			p.End = c.Seq
+			p.Duration = c.Time - start
+			p = nil
+		}
+	}, pin)
+	return ps
+}
+
+func (t Trace) risingEdges(pin int, pins []int) []Sample {
+	var ss []Sample
+	t.replay(func(c Call, levels map[int]bool, prev bool) {
+		if prev || !levels[pin] {
+			return
+		}
+		s := Sample{Seq: c.Seq}
+		for i, p := range pins {
+			if levels[p] {
+				s.Bits |= 1 << uint32(i)
+			}
+		}
+		ss = append(ss, s)
+	}, pin)
+	return ss
+}
+
+// replay replays the writes of the trace, all pins starting low, and calls fn
+// after each write with the pin levels and the previous level of pin.
+func (t Trace) replay(fn func(c Call, levels map[int]bool, prev bool), pin int) {
+	levels := make(map[int]bool)
+	for _, c := range t {
+		if c.Op != DigitalWrite && c.Op != DigitalWrites {
+			continue
+		}
+		prev := levels[pin]
+		for _, pv := range c.Values {
+			levels[pv.Pin] = pv.Value
+		}
+		fn(c, levels, prev)
+	}
+}
@@ -0,0 +1,254 @@
+// Package gpiocdev implements board.Board over a Linux GPIO character device,
+// /dev/gpiochipN, using the v2 uAPI line requests. It runs on any Linux board
+// without root, but every access is a system call, so it is much slower than
+// the memory mapped boards.
+package gpiocdev
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/post-l/hw/board"
+)
+
+const consumer = "hw"
+
+// Board is a GPIO chip. Pins are the chip line offsets. All the configured
+// lines are held by a single line request, so DigitalWrites sets them with a
+// single ioctl.
+type Board struct {
+	dev    device
+	chipFd int
+	reqFd  int
+	// numLines is the number of lines of the chip.
+	numLines int
+
+	// lines holds the requested line offsets, in request order.
+	lines []uint32
+	// idx maps a pin to its index in lines.
+	idx     map[int]int
+	outputs uint64
+	values  uint64
+
+	// err is the first error reading or writing the lines.
+	err error
+}
+
+// New opens the GPIO chip at path, like /dev/gpiochip0.
+func New(path string) (*Board, error) {
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return newBoard(sysDevice{}, fd)
+}
+
+func newBoard(dev device, chipFd int) (*Board, error) {
+	var info chipInfo
+	if err := dev.ioctl(chipFd, getChipInfoIoctl, unsafe.Pointer(&info)); err != nil {
+		dev.close(chipFd)
+		return nil, fmt.Errorf("gpiocdev: unable to get chip info: %v", err)
+	}
+	return &Board{
+		dev:      dev,
+		chipFd:   chipFd,
+		reqFd:    -1,
+		numLines: int(info.lines),
+		idx:      make(map[int]int),
+	}, nil
+}
+
+// Close releases the lines and closes the chip. It returns the first error
+// reading or writing the lines, if any.
+func (b *Board) Close() error {
+	if b.reqFd >= 0 {
+		b.dev.close(b.reqFd)
+		b.reqFd = -1
+	}
+	if err := b.dev.close(b.chipFd); err != nil {
+		return err
+	}
+	return b.err
+}
+
+// Err returns the first error reading or writing the lines, which
+// DigitalRead and the writes cannot return.
+func (b *Board) Err() error {
+	return b.err
+}
+
+// Pins returns the chip line offsets.
+func (b *Board) Pins() []int {
+	pins := make([]int, b.numLines)
+	for i := range pins {
+		pins[i] = i
+	}
+	return pins
+}
+
+// SetPinMode requests the line if not already, which releases and requests
+// again all the lines, or reconfigures it.
+func (b *Board) SetPinMode(pin int, mode board.PinMode) error {
+	if pin < 0 || pin >= b.numLines {
+		return fmt.Errorf("gpiocdev: %w", board.InvalidPinError(pin))
+	}
+	i, ok := b.idx[pin]
+	if !ok {
+		if len(b.lines) == linesMax {
+			return fmt.Errorf("gpiocdev: unable to request pin %d: too many lines requested", pin)
+		}
+		i = len(b.lines)
+		b.lines = append(b.lines, uint32(pin))
+		b.idx[pin] = i
+	}
+	if mode == board.Output {
+		b.outputs |= 1 << uint(i)
+	} else {
+		b.outputs &= ^(1 << uint(i))
+	}
+	if ok {
+		cfg := b.lineConfig()
+		if err := b.dev.ioctl(b.reqFd, lineSetConfigIoctl, unsafe.Pointer(&cfg)); err != nil {
+			return fmt.Errorf("gpiocdev: unable to configure pin %d: %v", pin, err)
+		}
+		return nil
+	}
+	if err := b.request(); err != nil {
+		b.lines = b.lines[:i]
+		delete(b.idx, pin)
+		b.outputs &= ^(1 << uint(i))
+		return err
+	}
+	return nil
+}
+
+func (b *Board) DigitalRead(pin int) bool {
+	i, ok := b.idx[pin]
+	if !ok {
+		return false
+	}
+	lv := lineValues{mask: 1 << uint(i)}
+	if err := b.dev.ioctl(b.reqFd, lineGetValuesIoctl, unsafe.Pointer(&lv)); err != nil {
+		b.setErr(fmt.Errorf("gpiocdev: unable to read pin %d: %w", pin, err))
+		return false
+	}
+	return lv.bits&lv.mask != 0
+}
+
+func (b *Board) DigitalWrite(pin int, v bool) {
+	i, ok := b.idx[pin]
+	if !ok {
+		return
+	}
+	var bits uint64
+	if v {
+		bits = 1 << uint(i)
+	}
+	b.setValues(bits, 1<<uint(i))
+}
+
+func (b *Board) DigitalWrites(pvs []board.PinValue) {
+	var bits, mask uint64
+	for _, pv := range pvs {
+		i, ok := b.idx[pv.Pin]
+		if !ok {
+			continue
+		}
+		mask |= 1 << uint(i)
+		if pv.Value {
+			bits |= 1 << uint(i)
+		}
+	}
+	if mask == 0 {
+		return
+	}
+	b.setValues(bits, mask)
+}
+
+// NewPinWriter returns a board.PinWriter with the line masks computed ahead,
+// writing the pins with a single ioctl. The pins must be configured before.
+func (b *Board) NewPinWriter(pins []int) board.PinWriter {
+	pw := &pinWriter{
+		b:    b,
+		bits: make([]uint64, len(pins)),
+	}
+	for i, pin := range pins {
+		if j, ok := b.idx[pin]; ok {
+			pw.bits[i] = 1 << uint(j)
+			pw.mask |= pw.bits[i]
+		}
+	}
+	return pw
+}
+
+func (b *Board) setValues(bits, mask uint64) {
+	lv := lineValues{bits: bits, mask: mask}
+	if err := b.dev.ioctl(b.reqFd, lineSetValuesIoctl, unsafe.Pointer(&lv)); err != nil {
+		b.setErr(fmt.Errorf("gpiocdev: unable to write lines %b: %w", mask, err))
+		return
+	}
+	b.values = b.values&^mask | bits&mask
+}
+
+func (b *Board) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *Board) request() error {
+	if b.reqFd >= 0 {
+		b.dev.close(b.reqFd)
+		b.reqFd = -1
+	}
+	var req lineRequest
+	copy(req.offsets[:], b.lines)
+	copy(req.consumer[:], consumer)
+	req.config = b.lineConfig()
+	req.numLines = uint32(len(b.lines))
+	if err := b.dev.ioctl(b.chipFd, getLineIoctl, unsafe.Pointer(&req)); err != nil {
+		return fmt.Errorf("gpiocdev: unable to request lines %v: %v", b.lines, err)
+	}
+	b.reqFd = int(req.fd)
+	return nil
+}
+
+// lineConfig returns the configuration of the requested lines, inputs by
+// default, outputs keeping their last written value.
+func (b *Board) lineConfig() lineConfig {
+	cfg := lineConfig{flags: lineFlagInput}
+	if b.outputs != 0 {
+		cfg.attrs[0] = lineConfigAttribute{
+			attr: lineAttribute{id: lineAttrIDFlags, value: lineFlagOutput},
+			mask: b.outputs,
+		}
+		cfg.attrs[1] = lineConfigAttribute{
+			attr: lineAttribute{id: lineAttrIDOutputValues, value: b.values},
+			mask: b.outputs,
+		}
+		cfg.numAttrs = 2
+	}
+	return cfg
+}
+
+type pinWriter struct {
+	b    *Board
+	bits []uint64
+	mask uint64
+	v    uint64
+}
+
+func (pw *pinWriter) Set(val uint32) {
+	pw.v = 0
+	for i, bit := range pw.bits {
+		if val&(1<<uint32(i)) != 0 {
+			pw.v |= bit
+		}
+	}
+}
+
+func (pw *pinWriter) Write() {
+	pw.b.setValues(pw.v, pw.mask)
+}
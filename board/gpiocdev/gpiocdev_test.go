@@ -0,0 +1,157 @@
+package gpiocdev
+
+import (
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/post-l/hw/board"
+)
+
+// stubDevice emulates a GPIO chip line request.
+type stubDevice struct {
+	requests  []lineRequest
+	configs   []lineConfig
+	setValues []lineValues
+	values    uint64
+	closed    []int
+	// err is returned by the line value ioctls.
+	err error
+}
+
+func (d *stubDevice) ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	if d.err != nil && (req == lineSetValuesIoctl || req == lineGetValuesIoctl) {
+		return d.err
+	}
+	switch req {
+	case getChipInfoIoctl:
+		(*chipInfo)(arg).lines = 32
+	case getLineIoctl:
+		r := (*lineRequest)(arg)
+		r.fd = int32(100 + len(d.requests))
+		d.requests = append(d.requests, *r)
+	case lineSetConfigIoctl:
+		d.configs = append(d.configs, *(*lineConfig)(arg))
+	case lineSetValuesIoctl:
+		lv := (*lineValues)(arg)
+		d.values = d.values&^lv.mask | lv.bits&lv.mask
+		d.setValues = append(d.setValues, *lv)
+	case lineGetValuesIoctl:
+		lv := (*lineValues)(arg)
+		lv.bits = d.values & lv.mask
+	}
+	return nil
+}
+
+func (d *stubDevice) close(fd int) error {
+	d.closed = append(d.closed, fd)
+	return nil
+}
+
+func TestUAPISizes(t *testing.T) {
+	if got, want := unsafe.Sizeof(lineRequest{}), uintptr(592); got != want {
+		t.Errorf("invalid line request size: got %d; want %d", got, want)
+	}
+	if got, want := unsafe.Sizeof(lineConfig{}), uintptr(272); got != want {
+		t.Errorf("invalid line config size: got %d; want %d", got, want)
+	}
+	if got, want := getLineIoctl, uintptr(0xc250b407); got != want {
+		t.Errorf("invalid get line ioctl: got %#x; want %#x", got, want)
+	}
+}
+
+func TestBoard(t *testing.T) {
+	d := &stubDevice{}
+	b, err := newBoard(d, 3)
+	if err != nil {
+		t.Fatalf("expect newBoard to return no error: %v", err)
+	}
+	for _, pin := range []int{17, 4} {
+		if err := b.SetPinMode(pin, board.Output); err != nil {
+			t.Fatalf("expect SetPinMode to return no error: %v", err)
+		}
+	}
+	if err := b.SetPinMode(22, board.Input); err != nil {
+		t.Fatalf("expect SetPinMode to return no error: %v", err)
+	}
+	if err := b.SetPinMode(32, board.Input); !errors.Is(err, board.ErrInvalidPin) {
+		t.Errorf("invalid SetPinMode error: got %v; want %v", err, board.ErrInvalidPin)
+	}
+
+	if got, want := len(d.requests), 3; got != want {
+		t.Fatalf("invalid number of line requests: got %d; want %d", got, want)
+	}
+	req := d.requests[2]
+	if got, want := req.numLines, uint32(3); got != want {
+		t.Errorf("invalid number of lines: got %d; want %d", got, want)
+	}
+	if got, want := req.offsets[:3], []uint32{17, 4, 22}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid line offsets: got %v; want %v", got, want)
+	}
+	if got, want := req.config.attrs[0].mask, uint64(3); got != want {
+		t.Errorf("invalid output lines mask: got %b; want %b", got, want)
+	}
+	if got, want := d.closed, []int{100, 101}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid released requests: got %v; want %v", got, want)
+	}
+
+	b.DigitalWrites([]board.PinValue{{Pin: 17, Value: true}, {Pin: 4, Value: false}, {Pin: 5, Value: true}})
+	if got, want := d.setValues, []lineValues{{bits: 1, mask: 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid set values: got %v; want %v", got, want)
+	}
+	if got, want := b.DigitalRead(17), true; got != want {
+		t.Errorf("invalid digital read value: got %v; want %v", got, want)
+	}
+
+	pw := b.NewPinWriter([]int{4, 17})
+	pw.Set(1)
+	pw.Write()
+	if got, want := d.values, uint64(2); got != want {
+		t.Errorf("invalid line values: got %b; want %b", got, want)
+	}
+
+	b.SetPinMode(17, board.Input)
+	if got, want := len(d.configs), 1; got != want {
+		t.Fatalf("invalid number of line reconfigurations: got %d; want %d", got, want)
+	}
+	if got, want := d.configs[0].attrs[0].mask, uint64(2); got != want {
+		t.Errorf("invalid output lines mask: got %b; want %b", got, want)
+	}
+
+	b.Close()
+	if got, want := d.closed, []int{100, 101, 102, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid closed fds: got %v; want %v", got, want)
+	}
+}
+
+func TestValuesError(t *testing.T) {
+	d := &stubDevice{}
+	b, err := newBoard(d, 3)
+	if err != nil {
+		t.Fatalf("expect newBoard to return no error: %v", err)
+	}
+	if err := b.SetPinMode(17, board.Output); err != nil {
+		t.Fatalf("expect SetPinMode to return no error: %v", err)
+	}
+	b.DigitalWrite(17, true)
+	if err := b.Err(); err != nil {
+		t.Fatalf("expect Err to return no error: %v", err)
+	}
+
+	d.err = syscall.EIO
+	b.DigitalWrite(17, false)
+	d.err = syscall.EBUSY
+	b.DigitalRead(17)
+	if got, want := b.Err(), syscall.EIO; !errors.Is(got, want) {
+		t.Errorf("invalid error: got %v; want %v", got, want)
+	}
+	// The failed write is not kept as the line output value.
+	if got, want := b.values, uint64(1); got != want {
+		t.Errorf("invalid line values: got %b; want %b", got, want)
+	}
+	if got, want := b.Close(), syscall.EIO; !errors.Is(got, want) {
+		t.Errorf("invalid Close error: got %v; want %v", got, want)
+	}
+}
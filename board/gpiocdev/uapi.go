@@ -0,0 +1,106 @@
+package gpiocdev
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Linux GPIO character device v2 uAPI, see include/uapi/linux/gpio.h.
+
+const (
+	linesMax    = 64
+	numAttrsMax = 10
+)
+
+const (
+	lineFlagInput  = 1 << 2
+	lineFlagOutput = 1 << 3
+)
+
+const (
+	lineAttrIDFlags        = 1
+	lineAttrIDOutputValues = 2
+)
+
+type lineAttribute struct {
+	id      uint32
+	padding uint32
+	// value holds the flags, the output values or the debounce period in
+	// microseconds depending on id.
+	value uint64
+}
+
+type lineConfigAttribute struct {
+	attr lineAttribute
+	mask uint64
+}
+
+type lineConfig struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [numAttrsMax]lineConfigAttribute
+}
+
+type lineRequest struct {
+	offsets         [linesMax]uint32
+	consumer        [32]byte
+	config          lineConfig
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+type lineValues struct {
+	bits uint64
+	mask uint64
+}
+
+type chipInfo struct {
+	name  [32]byte
+	label [32]byte
+	lines uint32
+}
+
+var (
+	getChipInfoIoctl   = ior(0x01, unsafe.Sizeof(chipInfo{}))
+	getLineIoctl       = iowr(0x07, unsafe.Sizeof(lineRequest{}))
+	lineSetConfigIoctl = iowr(0x0d, unsafe.Sizeof(lineConfig{}))
+	lineGetValuesIoctl = iowr(0x0e, unsafe.Sizeof(lineValues{}))
+	lineSetValuesIoctl = iowr(0x0f, unsafe.Sizeof(lineValues{}))
+)
+
+const (
+	iocRead  = 2
+	iocWrite = 1
+	gpioType = 0xb4
+)
+
+func ior(nr, size uintptr) uintptr {
+	return iocRead<<30 | size<<16 | gpioType<<8 | nr
+}
+
+func iowr(nr, size uintptr) uintptr {
+	return (iocRead|iocWrite)<<30 | size<<16 | gpioType<<8 | nr
+}
+
+// device is the system call layer used by Board, stubbed in tests.
+type device interface {
+	ioctl(fd int, req uintptr, arg unsafe.Pointer) error
+	close(fd int) error
+}
+
+type sysDevice struct{}
+
+func (sysDevice) ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (sysDevice) close(fd int) error {
+	return syscall.Close(fd)
+}
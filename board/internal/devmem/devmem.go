@@ -0,0 +1,50 @@
+// Package devmem maps physical memory blocks from /dev/mem like devices.
+package devmem
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"unsafe"
+)
+
+// File is an opened memory device.
+type File struct {
+	f    *os.File
+	maps [][]byte
+}
+
+// Open opens the memory device at path, like /dev/mem or /dev/gpiomem.
+func Open(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_SYNC, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: f}, nil
+}
+
+// Map maps length bytes of the device at offset as 32 bits registers.
+func (f *File) Map(offset int64, length int) ([]uint32, error) {
+	m, err := syscall.Mmap(int(f.f.Fd()), offset, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	f.maps = append(f.maps, m)
+	return toUInt32Slice(m), nil
+}
+
+// Close unmaps all the mapped blocks and closes the device.
+func (f *File) Close() error {
+	for _, m := range f.maps {
+		syscall.Munmap(m)
+	}
+	f.maps = nil
+	return f.f.Close()
+}
+
+func toUInt32Slice(m []byte) []uint32 {
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&m))
+	h.Len /= 4
+	h.Cap /= 4
+	return *(*[]uint32)(unsafe.Pointer(h))
+}
@@ -0,0 +1,111 @@
+package board
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PWM is implemented by boards generating PWM signals.
+type PWM interface {
+	// SetPWM outputs on pin a signal of the given period, high during duty.
+	// A zero period stops the signal, leaving the pin low.
+	SetPWM(pin int, period, duty time.Duration) error
+}
+
+// NewPWM returns b if it implements PWM, a SoftPWM on b otherwise.
+func NewPWM(b Board) PWM {
+	if pwm, ok := b.(PWM); ok {
+		return pwm
+	}
+	return NewSoftPWM(b)
+}
+
+// SoftPWM generates PWM signals on any board, toggling each pin from its own
+// goroutine. Its timing is only as good as the goroutine scheduling, which is
+// fine to dim a LED but not for precise signals.
+type SoftPWM struct {
+	b Board
+
+	mu   sync.Mutex
+	pins map[int]*softPWMPin
+}
+
+type softPWMPin struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSoftPWM returns a SoftPWM generating signals on b.
+func NewSoftPWM(b Board) *SoftPWM {
+	return &SoftPWM{
+		b:    b,
+		pins: make(map[int]*softPWMPin),
+	}
+}
+
+func (sp *SoftPWM) SetPWM(pin int, period, duty time.Duration) error {
+	if period < 0 || duty < 0 || duty > period {
+		return fmt.Errorf("invalid pwm period %v and duty %v", period, duty)
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.stop(pin)
+	if period == 0 {
+		sp.b.DigitalWrite(pin, false)
+		return nil
+	}
+	if err := sp.b.SetPinMode(pin, Output); err != nil {
+		return err
+	}
+	if duty == 0 || duty == period {
+		sp.b.DigitalWrite(pin, duty == period)
+		return nil
+	}
+	p := &softPWMPin{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	sp.pins[pin] = p
+	go p.run(sp.b, pin, period, duty)
+	return nil
+}
+
+// Close stops all the signals, leaving the pins low.
+func (sp *SoftPWM) Close() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for pin := range sp.pins {
+		sp.stop(pin)
+		sp.b.DigitalWrite(pin, false)
+	}
+	return nil
+}
+
+func (sp *SoftPWM) stop(pin int) {
+	p, ok := sp.pins[pin]
+	if !ok {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	delete(sp.pins, pin)
+}
+
+func (p *softPWMPin) run(b Board, pin int, period, duty time.Duration) {
+	defer close(p.done)
+	v := true
+	for {
+		b.DigitalWrite(pin, v)
+		d := duty
+		if !v {
+			d = period - duty
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(d):
+		}
+		v = !v
+	}
+}
@@ -0,0 +1,43 @@
+package board_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/fake"
+)
+
+func TestSoftPWM(t *testing.T) {
+	const pin = 3
+	b := fake.New()
+	pwm := board.NewPWM(b)
+	if err := pwm.SetPWM(pin, 4*time.Millisecond, 2*time.Millisecond); err != nil {
+		t.Fatalf("expect SetPWM to return no error: %v", err)
+	}
+	if got, want := b.Mode(pin), board.Output; got != want {
+		t.Errorf("invalid pin mode: got %v; want %v", got, want)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if err := pwm.SetPWM(pin, time.Millisecond, time.Millisecond); err != nil {
+		t.Fatalf("expect SetPWM to return no error: %v", err)
+	}
+	if got, want := b.DigitalRead(pin), true; got != want {
+		t.Errorf("invalid level at full duty: got %v; want %v", got, want)
+	}
+	pulses := b.Trace().Pulses(pin, true)
+	// Leave room for a slow scheduler.
+	if n := len(pulses); n < 3 || n > 11 {
+		t.Errorf("invalid number of pulses in 10 periods: %d", n)
+	}
+
+	if err := pwm.SetPWM(pin, time.Millisecond, 2*time.Millisecond); err == nil {
+		t.Error("expect SetPWM to return an error for a duty longer than the period")
+	}
+	if err := pwm.SetPWM(pin, 0, 0); err != nil {
+		t.Fatalf("expect SetPWM to return no error: %v", err)
+	}
+	if got, want := b.DigitalRead(pin), false; got != want {
+		t.Errorf("invalid level after stop: got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,23 @@
+package rpi
+
+const (
+	blockSize = 4096
+
+	// gpioOffset is the offset of the GPIO block from the peripheral base.
+	gpioOffset int64 = 0x00200000
+
+	BCM2835_PERI_BASE int64 = 0x20000000
+	BCM2836_PERI_BASE int64 = 0x3f000000
+	BCM2711_PERI_BASE int64 = 0xfe000000
+)
+
+// PinCount is the number of GPIO pins of the BCM2711, the BCM283x having the
+// 54 first ones.
+const PinCount = 58
+
+const (
+	GPFSEL0_OFFSET = 0x0000
+	GPSET0_OFFSET  = 0x001c
+	GPCLR0_OFFSET  = 0x0028
+	GPLEV0_OFFSET  = 0x0034
+)
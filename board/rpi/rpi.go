@@ -0,0 +1,179 @@
+// Package rpi implements board.Board for the Raspberry Pi BCM283x and
+// BCM2711 GPIO, accessing the registers through memory mapping.
+package rpi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/internal/devmem"
+)
+
+// RaspberryPi is a Raspberry Pi GPIO. Pins are the BCM GPIO numbers.
+type RaspberryPi struct {
+	mem  board.Memory
+	gpio []uint32
+}
+
+// New maps the GPIO registers from /dev/gpiomem, which does not need root,
+// falling back to /dev/mem.
+func New() (*RaspberryPi, error) {
+	if mem, err := devmem.Open("/dev/gpiomem"); err == nil {
+		return NewWithMemory(mem, 0)
+	}
+	mem, err := devmem.Open("/dev/mem")
+	if err != nil {
+		return nil, err
+	}
+	return NewWithMemory(mem, peripheralBase()+gpioOffset)
+}
+
+// NewWithMemory returns a RaspberryPi using the GPIO registers mapped from
+// mem at offset. The RaspberryPi owns mem and closes it on Close.
+func NewWithMemory(mem board.Memory, offset int64) (*RaspberryPi, error) {
+	gpio, err := mem.Map(offset, blockSize)
+	if err != nil {
+		mem.Close()
+		return nil, fmt.Errorf("unable to map gpio: %v", err)
+	}
+	return &RaspberryPi{
+		mem:  mem,
+		gpio: gpio,
+	}, nil
+}
+
+func (rp *RaspberryPi) Close() error {
+	return rp.mem.Close()
+}
+
+// Pins returns the GPIO pins, 0 to PinCount-1.
+func (rp *RaspberryPi) Pins() []int {
+	pins := make([]int, PinCount)
+	for i := range pins {
+		pins[i] = i
+	}
+	return pins
+}
+
+func (rp *RaspberryPi) SetPinMode(pin int, mode board.PinMode) error {
+	if pin < 0 || pin >= PinCount {
+		return fmt.Errorf("rpi: %w", board.InvalidPinError(pin))
+	}
+	reg := GPFSEL0_OFFSET/4 + pin/10
+	shift := uint32(pin%10) * 3
+	v := rp.gpio[reg] & ^(7 << shift)
+	if mode == board.Output {
+		v |= 1 << shift
+	}
+	rp.gpio[reg] = v
+	return nil
+}
+
+// DigitalRead returns false for pins out of 0..PinCount-1.
+func (rp *RaspberryPi) DigitalRead(pin int) bool {
+	if pin < 0 || pin >= PinCount {
+		return false
+	}
+	return rp.gpio[GPLEV0_OFFSET/4+pin/32]&(1<<uint32(pin%32)) != 0
+}
+
+// DigitalWrite ignores pins out of 0..PinCount-1.
+func (rp *RaspberryPi) DigitalWrite(pin int, v bool) {
+	if pin < 0 || pin >= PinCount {
+		return
+	}
+	reg := GPCLR0_OFFSET/4 + pin/32
+	if v {
+		reg = GPSET0_OFFSET/4 + pin/32
+	}
+	rp.gpio[reg] = 1 << uint32(pin%32)
+}
+
+// DigitalWrites writes all the pins through the set and clear registers, so
+// pins not written are never touched. Pins out of 0..PinCount-1 are skipped.
+func (rp *RaspberryPi) DigitalWrites(pvs []board.PinValue) {
+	var set, clr [2]uint32
+	for _, pv := range pvs {
+		if pv.Pin < 0 || pv.Pin >= PinCount {
+			continue
+		}
+		bit := uint32(1 << uint32(pv.Pin%32))
+		if pv.Value {
+			set[pv.Pin/32] |= bit
+		} else {
+			clr[pv.Pin/32] |= bit
+		}
+	}
+	rp.writeBits(set, clr)
+}
+
+// NewPinWriter returns a board.PinWriter with the register bits of the pins
+// computed ahead. Pins out of 0..PinCount-1 are never written.
+func (rp *RaspberryPi) NewPinWriter(pins []int) board.PinWriter {
+	pw := &pinWriter{
+		rp:   rp,
+		bits: make([]pinBit, len(pins)),
+	}
+	for i, pin := range pins {
+		if pin < 0 || pin >= PinCount {
+			continue
+		}
+		pw.bits[i] = pinBit{bank: pin / 32, bit: 1 << uint32(pin%32)}
+	}
+	return pw
+}
+
+func (rp *RaspberryPi) writeBits(set, clr [2]uint32) {
+	for bank := range set {
+		if set[bank] != 0 {
+			rp.gpio[GPSET0_OFFSET/4+bank] = set[bank]
+		}
+		if clr[bank] != 0 {
+			rp.gpio[GPCLR0_OFFSET/4+bank] = clr[bank]
+		}
+	}
+}
+
+type pinBit struct {
+	bank int
+	bit  uint32
+}
+
+type pinWriter struct {
+	rp       *RaspberryPi
+	bits     []pinBit
+	set, clr [2]uint32
+}
+
+func (pw *pinWriter) Set(val uint32) {
+	pw.set = [2]uint32{}
+	pw.clr = [2]uint32{}
+	for i, pb := range pw.bits {
+		if val&(1<<uint32(i)) != 0 {
+			pw.set[pb.bank] |= pb.bit
+		} else {
+			pw.clr[pb.bank] |= pb.bit
+		}
+	}
+}
+
+func (pw *pinWriter) Write() {
+	pw.rp.writeBits(pw.set, pw.clr)
+}
+
+// peripheralBase returns the peripheral base address from the device tree,
+// defaulting to the BCM2835 one.
+func peripheralBase() int64 {
+	ranges, err := ioutil.ReadFile("/proc/device-tree/soc/ranges")
+	if err != nil || len(ranges) < 8 {
+		return BCM2835_PERI_BASE
+	}
+	// The BCM2711 uses 64 bits parent addresses, the first 32 bits being 0.
+	base := binary.BigEndian.Uint32(ranges[4:8])
+	if base == 0 && len(ranges) >= 12 {
+		base = binary.BigEndian.Uint32(ranges[8:12])
+	}
+	return int64(base)
+}
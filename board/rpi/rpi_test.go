@@ -0,0 +1,104 @@
+package rpi_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/rpi"
+)
+
+type memory struct {
+	gpio   []uint32
+	offset int64
+	closed bool
+}
+
+func (m *memory) Map(offset int64, length int) ([]uint32, error) {
+	m.offset = offset
+	m.gpio = make([]uint32, length/4)
+	return m.gpio, nil
+}
+
+func (m *memory) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestBoard(t *testing.T) {
+	mem := &memory{}
+	rp, err := rpi.NewWithMemory(mem, 0x3f200000)
+	if err != nil {
+		t.Fatalf("expect NewWithMemory to return no error: %v", err)
+	}
+	if got, want := mem.offset, int64(0x3f200000); got != want {
+		t.Errorf("invalid mapped offset: got %#x; want %#x", got, want)
+	}
+
+	mem.gpio[rpi.GPFSEL0_OFFSET/4+1] = 0xffffffff
+	if err := rp.SetPinMode(17, board.Output); err != nil {
+		t.Fatalf("expect SetPinMode to return no error: %v", err)
+	}
+	if err := rp.SetPinMode(13, board.Input); err != nil {
+		t.Fatalf("expect SetPinMode to return no error: %v", err)
+	}
+	if err := rp.SetPinMode(rpi.PinCount, board.Input); !errors.Is(err, board.ErrInvalidPin) {
+		t.Errorf("invalid SetPinMode error: got %v; want %v", err, board.ErrInvalidPin)
+	}
+	if got, want := mem.gpio[rpi.GPFSEL0_OFFSET/4+1], uint32(0xfffff1ff&^(7<<21)|1<<21); got != want {
+		t.Errorf("invalid GPFSEL1: got %#x; want %#x", got, want)
+	}
+
+	rp.DigitalWrites([]board.PinValue{{Pin: 17, Value: true}, {Pin: 4, Value: false}, {Pin: 40, Value: true}})
+	if got, want := mem.gpio[rpi.GPSET0_OFFSET/4], uint32(1<<17); got != want {
+		t.Errorf("invalid GPSET0: got %#x; want %#x", got, want)
+	}
+	if got, want := mem.gpio[rpi.GPSET0_OFFSET/4+1], uint32(1<<8); got != want {
+		t.Errorf("invalid GPSET1: got %#x; want %#x", got, want)
+	}
+	if got, want := mem.gpio[rpi.GPCLR0_OFFSET/4], uint32(1<<4); got != want {
+		t.Errorf("invalid GPCLR0: got %#x; want %#x", got, want)
+	}
+
+	pw := rp.NewPinWriter([]int{22, 23})
+	pw.Set(2)
+	pw.Write()
+	if got, want := mem.gpio[rpi.GPSET0_OFFSET/4], uint32(1<<23); got != want {
+		t.Errorf("invalid GPSET0: got %#x; want %#x", got, want)
+	}
+	if got, want := mem.gpio[rpi.GPCLR0_OFFSET/4], uint32(1<<22); got != want {
+		t.Errorf("invalid GPCLR0: got %#x; want %#x", got, want)
+	}
+
+	mem.gpio[rpi.GPLEV0_OFFSET/4] = 1 << 13
+	if got, want := rp.DigitalRead(13), true; got != want {
+		t.Errorf("invalid digital read value: got %v; want %v", got, want)
+	}
+
+	// Out of range pins are ignored rather than touching other registers.
+	mem.gpio[rpi.GPLEV0_OFFSET/4+1] = 0xffffffff
+	for _, pin := range []int{-1, rpi.PinCount, 64} {
+		if got, want := rp.DigitalRead(pin), false; got != want {
+			t.Errorf("invalid digital read value of pin %d: got %v; want %v", pin, got, want)
+		}
+	}
+	before := append([]uint32(nil), mem.gpio...)
+	rp.DigitalWrite(rpi.PinCount, true)
+	rp.DigitalWrite(-1, false)
+	rp.DigitalWrites([]board.PinValue{{Pin: -1, Value: true}, {Pin: 64, Value: false}, {Pin: rpi.PinCount, Value: true}})
+	pw = rp.NewPinWriter([]int{-1, 64, rpi.PinCount})
+	for _, v := range []uint32{0, 7} {
+		pw.Set(v)
+		pw.Write()
+	}
+	for i := range before {
+		if got, want := mem.gpio[i], before[i]; got != want {
+			t.Errorf("invalid register %#x after invalid pin writes: got %#x; want %#x", i*4, got, want)
+		}
+	}
+
+	rp.Close()
+	if !mem.closed {
+		t.Error("expect Close to close the memory")
+	}
+}
@@ -0,0 +1,156 @@
+// Package sysfs implements board.Board over the legacy Linux sysfs GPIO
+// interface, for older kernels without the GPIO character device.
+package sysfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/post-l/hw/board"
+)
+
+// DefaultRoot is the sysfs GPIO directory.
+const DefaultRoot = "/sys/class/gpio"
+
+// Board is the sysfs GPIO interface rooted at a directory. Pins are the
+// kernel GPIO numbers.
+type Board struct {
+	root string
+	// values holds the opened value file of each configured pin.
+	values map[int]*os.File
+	// exported holds the pins exported by the Board, unexported on Close.
+	exported []int
+
+	// err is the first error reading or writing the values.
+	err error
+}
+
+// New returns a Board using the sysfs GPIO directory root, usually
+// DefaultRoot.
+func New(root string) (*Board, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+	return &Board{
+		root:   root,
+		values: make(map[int]*os.File),
+	}, nil
+}
+
+// Close closes the value files and unexports the pins exported by the Board.
+// It returns the first error reading or writing the values, if any, or else
+// the first error closing or unexporting them.
+func (b *Board) Close() error {
+	err := b.err
+	for pin, f := range b.values {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("sysfs: unable to close pin %d value: %w", pin, cerr)
+		}
+		delete(b.values, pin)
+	}
+	for _, pin := range b.exported {
+		if uerr := b.write("unexport", strconv.Itoa(pin)); uerr != nil && err == nil {
+			err = fmt.Errorf("sysfs: unable to unexport pin %d: %w", pin, uerr)
+		}
+	}
+	b.exported = nil
+	return err
+}
+
+// Err returns the first error reading or writing the values, which
+// DigitalRead and the writes cannot return.
+func (b *Board) Err() error {
+	return b.err
+}
+
+// SetPinMode exports pin if needed, sets its direction and opens its value
+// file. The kernel refusing to export pin is reported as an invalid pin.
+func (b *Board) SetPinMode(pin int, mode board.PinMode) error {
+	if pin < 0 {
+		return fmt.Errorf("sysfs: %w", board.InvalidPinError(pin))
+	}
+	name := strconv.Itoa(pin)
+	dir := "gpio" + name
+	if _, err := os.Stat(filepath.Join(b.root, dir)); os.IsNotExist(err) {
+		if err := b.write("export", name); err != nil {
+			if errors.Is(err, syscall.EINVAL) {
+				return fmt.Errorf("sysfs: %w", board.InvalidPinError(pin))
+			}
+			return fmt.Errorf("sysfs: unable to export pin %d: %v", pin, err)
+		}
+		b.exported = append(b.exported, pin)
+	}
+	direction := "in"
+	if mode == board.Output {
+		direction = "out"
+	}
+	if err := b.write(filepath.Join(dir, "direction"), direction); err != nil {
+		return fmt.Errorf("sysfs: unable to set pin %d direction: %v", pin, err)
+	}
+	if _, ok := b.values[pin]; ok {
+		return nil
+	}
+	f, err := os.OpenFile(filepath.Join(b.root, dir, "value"), os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("sysfs: unable to open pin %d value: %v", pin, err)
+	}
+	b.values[pin] = f
+	return nil
+}
+
+func (b *Board) DigitalRead(pin int) bool {
+	f, ok := b.values[pin]
+	if !ok {
+		return false
+	}
+	var buf [1]byte
+	if _, err := f.ReadAt(buf[:], 0); err != nil {
+		b.setErr(fmt.Errorf("sysfs: unable to read pin %d: %w", pin, err))
+		return false
+	}
+	return buf[0] == '1'
+}
+
+func (b *Board) DigitalWrite(pin int, v bool) {
+	f, ok := b.values[pin]
+	if !ok {
+		return
+	}
+	buf := []byte{'0'}
+	if v {
+		buf[0] = '1'
+	}
+	if _, err := f.WriteAt(buf, 0); err != nil {
+		b.setErr(fmt.Errorf("sysfs: unable to write pin %d: %w", pin, err))
+	}
+}
+
+// DigitalWrites writes the pins one by one, sysfs having no way to write
+// several values at once.
+func (b *Board) DigitalWrites(pvs []board.PinValue) {
+	for _, pv := range pvs {
+		b.DigitalWrite(pv.Pin, pv.Value)
+	}
+}
+
+func (b *Board) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *Board) write(name, v string) error {
+	f, err := os.OpenFile(filepath.Join(b.root, name), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte(v))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
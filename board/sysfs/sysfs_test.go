@@ -0,0 +1,136 @@
+package sysfs_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/sysfs"
+)
+
+// newRoot returns a temporary directory mimicking the sysfs GPIO layout with
+// the given pins already exported.
+func newRoot(t *testing.T, pins ...string) string {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"export", "unexport"}
+	for _, pin := range pins {
+		if err := os.Mkdir(filepath.Join(root, "gpio"+pin), 0755); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, filepath.Join("gpio"+pin, "direction"), filepath.Join("gpio"+pin, "value"))
+	}
+	for _, name := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func readFile(t *testing.T, root, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBoard(t *testing.T) {
+	root := newRoot(t, "17")
+	defer os.RemoveAll(root)
+	b, err := sysfs.New(root)
+	if err != nil {
+		t.Fatalf("expect New to return no error: %v", err)
+	}
+
+	b.SetPinMode(17, board.Output)
+	if got, want := readFile(t, root, "gpio17/direction"), "out"; got != want {
+		t.Errorf("invalid direction: got %q; want %q", got, want)
+	}
+	b.DigitalWrite(17, true)
+	if got, want := readFile(t, root, "gpio17/value"), "1"; got != want {
+		t.Errorf("invalid value: got %q; want %q", got, want)
+	}
+	if got, want := b.DigitalRead(17), true; got != want {
+		t.Errorf("invalid digital read value: got %v; want %v", got, want)
+	}
+	b.DigitalWrites([]board.PinValue{{Pin: 17, Value: false}})
+	if got, want := b.DigitalRead(17), false; got != want {
+		t.Errorf("invalid digital read value: got %v; want %v", got, want)
+	}
+
+	b.SetPinMode(4, board.Input)
+	if got, want := readFile(t, root, "export"), "4"; got != want {
+		t.Errorf("invalid exported pin: got %q; want %q", got, want)
+	}
+
+	b.Close()
+	if got, want := readFile(t, root, "unexport"), "4"; got != want {
+		t.Errorf("invalid unexported pin: got %q; want %q", got, want)
+	}
+}
+
+func TestValuesError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to fail the writes")
+	}
+	root := newRoot(t, "17", "18")
+	defer os.RemoveAll(root)
+	// Writes to /dev/full fail even as root, unlike to a read-only file.
+	value := filepath.Join(root, "gpio17", "value")
+	if err := os.Remove(value); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/dev/full", value); err != nil {
+		t.Fatal(err)
+	}
+	b, err := sysfs.New(root)
+	if err != nil {
+		t.Fatalf("expect New to return no error: %v", err)
+	}
+	for _, pin := range []int{17, 18} {
+		if err := b.SetPinMode(pin, board.Output); err != nil {
+			t.Fatalf("expect SetPinMode to return no error: %v", err)
+		}
+	}
+	if err := b.Err(); err != nil {
+		t.Fatalf("expect Err to return no error: %v", err)
+	}
+
+	b.DigitalWrite(17, true)
+	// The empty value of pin 18 can't be read either.
+	b.DigitalRead(18)
+	if got, want := b.Err(), syscall.ENOSPC; !errors.Is(got, want) {
+		t.Errorf("invalid error: got %v; want %v", got, want)
+	}
+	if got, want := b.Close(), syscall.ENOSPC; !errors.Is(got, want) {
+		t.Errorf("invalid Close error: got %v; want %v", got, want)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	root := newRoot(t, "17")
+	defer os.RemoveAll(root)
+	b, err := sysfs.New(root)
+	if err != nil {
+		t.Fatalf("expect New to return no error: %v", err)
+	}
+	if err := b.SetPinMode(17, board.Input); err != nil {
+		t.Fatalf("expect SetPinMode to return no error: %v", err)
+	}
+	// The value file is empty.
+	if got, want := b.DigitalRead(17), false; got != want {
+		t.Errorf("invalid digital read value: got %v; want %v", got, want)
+	}
+	if got, want := b.Close(), io.EOF; !errors.Is(got, want) {
+		t.Errorf("invalid Close error: got %v; want %v", got, want)
+	}
+}
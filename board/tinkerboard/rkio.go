@@ -1,5 +1,7 @@
 package tinkerboard
 
+import "github.com/post-l/hw/board"
+
 const (
 	gpioLen      int64 = 0x00010000
 	gpioCh       int64 = 0x00020000
@@ -64,6 +66,20 @@ const (
 	GPIO8_B1 = (9 + 248) //9----->257
 )
 
+// gpioPins are the pins setGPIOPinMode can mux to GPIO, in increasing order.
+var gpioPins = []int{
+	GPIO0_C1,
+	GPIO1_D0,
+	GPIO5_B0, GPIO5_B1, GPIO5_B2, GPIO5_B3, GPIO5_B4, GPIO5_B5, GPIO5_B6, GPIO5_B7,
+	GPIO5_C0, GPIO5_C1, GPIO5_C2, GPIO5_C3,
+	GPIO6_A0, GPIO6_A1, GPIO6_A3, GPIO6_A4,
+	GPIO7_A7,
+	GPIO7_B0, GPIO7_B1, GPIO7_B2,
+	GPIO7_C1, GPIO7_C2, GPIO7_C6, GPIO7_C7,
+	GPIO8_A3, GPIO8_A4, GPIO8_A5, GPIO8_A6, GPIO8_A7,
+	GPIO8_B0, GPIO8_B1,
+}
+
 const (
 	GPIO_SWPORTA_DR_OFFSET    = 0x0000
 	GPIO_SWPORTA_DDR_OFFSET   = 0x0004
@@ -80,6 +96,8 @@ const (
 )
 
 const (
+	PMU_GPIO0A_P     = 0x0064
+	PMU_GPIO0A_E     = 0x0070
 	PMU_GPIO0C_IOMUX = 0x008c
 )
 
@@ -98,5 +116,58 @@ const (
 )
 
 const (
+	GRF_SOC_CON2 = 0x024c
+
+	// grfSocCon2PWMSel selects the RK PWM instead of the VOP one.
+	grfSocCon2PWMSel = 1 << 0
+)
+
+// PWM channel registers, channel n starting at n*PWM_CHANNEL_LEN.
+const (
+	PWM_CHANNEL_LEN = 0x0010
+
+	PWM_CNT_OFFSET        = 0x0000
+	PWM_PERIOD_HPR_OFFSET = 0x0004
+	PWM_DUTY_LPR_OFFSET   = 0x0008
+	PWM_CTRL_OFFSET       = 0x000c
+)
+
+const (
+	pwmCtrlEnable       = 1 << 0
+	pwmCtrlContinuous   = 1 << 1
+	pwmCtrlDutyPositive = 1 << 3
+
+	// pwmClkRate is the pclk_rkpwm rate set up by the kernel, in Hz.
+	pwmClkRate = 74250000
+)
+
+// pwmChannels maps the pins which can be muxed to PWM to their channel.
+var pwmChannels = map[int]uint32{
+	GPIO7_C6: 2,
+	GPIO7_C7: 3,
+}
+
+// pwmIOMux is the GRF_GPIO7CH_IOMUX function of the PWM pins.
+const pwmIOMux = 0x03
+
+// Pull and drive strength registers, one per 8 pins port, GPIO1A first.
+const (
+	GRF_GPIO1A_P = 0x0140
 	GRF_GPIO6A_P = 0x0190
+	GRF_GPIO1A_E = 0x01c0
 )
+
+// Pull register values.
+const (
+	pullZ    = 0
+	pullUp   = 1
+	pullDown = 2
+)
+
+// Drive strength register values.
+var driveStrengths = map[board.DriveStrength]uint32{
+	2:  0,
+	4:  1,
+	8:  2,
+	12: 3,
+}
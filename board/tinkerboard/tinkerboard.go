@@ -1,81 +1,79 @@
 package tinkerboard
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"reflect"
+	"math"
 	"sort"
-	"syscall"
-	"unsafe"
+	"sync"
+	"time"
 
 	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/internal/devmem"
 )
 
 type TinkerBoard struct {
+	mem board.Memory
+
+	// bankMu guards the read-modify-writes of the registers shared by the
+	// pins of each GPIO bank: mux, pull, drive strength, direction and
+	// interrupt registers.
+	bankMu [gpioBankLen]sync.Mutex
+
 	gpio [][]uint32
 	grf  []uint32
 	pwm  []uint32
 	pmu  []uint32
 	cru  []uint32
-
-	gpioMap [][]byte
-	grfMap  []byte
-	pwmMap  []byte
-	pmuMap  []byte
-	cruMap  []byte
 }
 
+// New maps the registers from /dev/mem, which needs root.
 func New() (*TinkerBoard, error) {
-	mem, err := os.OpenFile("/dev/mem", os.O_RDWR|os.O_SYNC, 0755)
+	mem, err := devmem.Open("/dev/mem")
 	if err != nil {
 		return nil, err
 	}
-	defer mem.Close()
+	return NewWithMemory(mem)
+}
+
+// NewWithMemory returns a TinkerBoard using the GPIO, GRF, PWM, PMU and CRU
+// registers mapped from mem at their physical addresses. The TinkerBoard owns
+// mem and closes it on Close.
+func NewWithMemory(mem board.Memory) (*TinkerBoard, error) {
 	tb := &TinkerBoard{
-		gpioMap: make([][]byte, gpioBankLen),
-		gpio:    make([][]uint32, gpioBankLen),
+		mem:  mem,
+		gpio: make([][]uint32, gpioBankLen),
 	}
-	memFd := int(mem.Fd())
+	var err error
 	for i := range tb.gpio {
 		offset := gpioBaseAddr + int64(i)*gpioLen
 		if i > 0 {
 			offset += gpioCh
 		}
-		tb.gpioMap[i], err = syscall.Mmap(memFd, offset, blockSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		tb.gpio[i], err = mem.Map(offset, blockSize)
 		if err != nil {
-			tb.Close()
+			mem.Close()
 			return nil, fmt.Errorf("unable to map gpio bank %d: %v", i, err)
 		}
-		tb.gpio[i] = mapToUInt32Slice(tb.gpioMap[i])
 	}
 
-	tb.grfMap, err = syscall.Mmap(memFd, RK3288_GRF_PHYS, blockSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-	if err != nil {
-		tb.Close()
-		return nil, fmt.Errorf("unable to map grf: %v", err)
+	blocks := []struct {
+		name   string
+		offset int64
+		regs   *[]uint32
+	}{
+		{"grf", RK3288_GRF_PHYS, &tb.grf},
+		{"pwm", RK3288_PWM, &tb.pwm},
+		{"pmu", RK3288_PMU, &tb.pmu},
+		{"cru", RK3288_CRU, &tb.cru},
 	}
-	tb.grf = mapToUInt32Slice(tb.grfMap)
-
-	tb.pwmMap, err = syscall.Mmap(memFd, RK3288_PWM, blockSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-	if err != nil {
-		tb.Close()
-		return nil, fmt.Errorf("unable to map pwm: %v", err)
-	}
-	tb.pwm = mapToUInt32Slice(tb.pwmMap)
-
-	tb.pmuMap, err = syscall.Mmap(memFd, RK3288_PMU, blockSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-	if err != nil {
-		tb.Close()
-		return nil, fmt.Errorf("unable to map pmu: %v", err)
-	}
-	tb.pmu = mapToUInt32Slice(tb.pmuMap)
-
-	tb.cruMap, err = syscall.Mmap(memFd, RK3288_CRU, blockSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-	if err != nil {
-		tb.Close()
-		return nil, fmt.Errorf("unable to map cru: %v", err)
+	for _, b := range blocks {
+		*b.regs, err = mem.Map(b.offset, blockSize)
+		if err != nil {
+			mem.Close()
+			return nil, fmt.Errorf("unable to map %s: %v", b.name, err)
+		}
 	}
-	tb.cru = mapToUInt32Slice(tb.cruMap)
 
 	tb.gpioClkEnable()
 
@@ -83,35 +81,38 @@ func New() (*TinkerBoard, error) {
 }
 
 func (tb *TinkerBoard) Close() error {
-	for _, data := range tb.gpioMap {
-		if data == nil {
-			return nil
-		}
-		syscall.Munmap(data)
-	}
-	d := [][]byte{tb.grfMap, tb.pwmMap, tb.pmuMap, tb.cruMap}
-	for _, data := range d {
-		if data == nil {
-			return nil
-		}
-		syscall.Munmap(data)
-	}
-	return nil
+	return tb.mem.Close()
 }
 
-func (tb *TinkerBoard) SetPinMode(pin int, mode board.PinMode) {
+// Pins returns the pins which can be muxed to GPIO.
+func (tb *TinkerBoard) Pins() []int {
+	return append([]int(nil), gpioPins...)
+}
+
+func (tb *TinkerBoard) SetPinMode(pin int, mode board.PinMode) error {
+	if err := board.CheckPin(tb, pin); err != nil {
+		return fmt.Errorf("tinkerboard: %w", err)
+	}
 	bank, bankPin := gpioToBank(pin)
-	tb.setGPIOPinMode(pin)
+	tb.bankMu[bank].Lock()
+	defer tb.bankMu[bank].Unlock()
+	if err := tb.setGPIOPinMode(pin); err != nil {
+		return err
+	}
 	switch mode {
 	case board.Input:
 		tb.gpio[bank][GPIO_SWPORTA_DDR_OFFSET/4] &= ^(1 << bankPin)
 	case board.Output:
 		tb.gpio[bank][GPIO_SWPORTA_DDR_OFFSET/4] |= (1 << bankPin)
 	}
+	return nil
 }
 
 func (tb *TinkerBoard) DigitalRead(pin int) bool {
 	bank, bankPin := gpioToBank(pin)
+	if bank >= gpioBankLen {
+		return false
+	}
 	r := tb.gpio[bank][GPIO_EXT_PORTA_OFFSET/4]
 	v := ((r & (1 << bankPin)) >> bankPin) != 0
 	return v
@@ -119,6 +120,9 @@ func (tb *TinkerBoard) DigitalRead(pin int) bool {
 
 func (tb *TinkerBoard) DigitalWrite(pin int, v bool) {
 	bank, bankPin := gpioToBank(pin)
+	if bank >= gpioBankLen {
+		return
+	}
 	if v {
 		tb.gpio[bank][GPIO_SWPORTA_DR_OFFSET/4] |= (1 << bankPin)
 	} else {
@@ -135,6 +139,9 @@ func (tb *TinkerBoard) DigitalWrites(pvs []board.PinValue) {
 		pin := pv.Pin
 		v := pv.Value
 		bank, bankPin := gpioToBank(pin)
+		if bank >= gpioBankLen {
+			continue
+		}
 		bitPin := uint32(1 << bankPin)
 		banks[bank].mask |= bitPin
 		if v {
@@ -156,6 +163,200 @@ func (tb *TinkerBoard) PerfWrites(bw *BankWriter) {
 	}
 }
 
+// NewPinWriter returns a board.PinWriter backed by a BankWriter, writing the
+// pins with one masked write per bank.
+func (tb *TinkerBoard) NewPinWriter(pins []int) board.PinWriter {
+	return &bankPinWriter{
+		BankWriter: NewBankWriter(pins),
+		tb:         tb,
+	}
+}
+
+// WatchEdges sets pin as input and watches its edges with the GPIO controller
+// edge detection, polling its raw interrupt status every
+// board.EdgePollInterval with the interrupt masked. The controller detects a
+// single edge polarity, so for board.BothEdges it is flipped after each edge.
+//
+// A non zero debounce enables the controller debounce filter, a fixed filter
+// dropping the glitches shorter than a few cycles of its debounce clock,
+// whatever the duration. The duration then only drops the edges following a
+// reported one by less than debounce, where board.WatchEdges polling waits
+// for the level to stay the same during debounce before reporting it.
+func (tb *TinkerBoard) WatchEdges(ctx context.Context, pin int, edge board.Edge, debounce time.Duration) (<-chan board.EdgeEvent, error) {
+	if err := tb.SetPinMode(pin, board.Input); err != nil {
+		return nil, err
+	}
+	bank, bankPin := gpioToBank(pin)
+	mu := &tb.bankMu[bank]
+	regs := tb.gpio[bank]
+	bit := uint32(1 << bankPin)
+	mu.Lock()
+	regs[GPIO_INTEN_OFFSET/4] &= ^bit
+	regs[GPIO_INTMASK_OFFSET/4] |= bit
+	regs[GPIO_INTTYPE_LEVEL_OFFSET/4] |= bit
+	if debounce > 0 {
+		regs[GPIO_DEBOUNCE_OFFSET/4] |= bit
+	} else {
+		regs[GPIO_DEBOUNCE_OFFSET/4] &= ^bit
+	}
+	polarity := edge
+	if edge == board.BothEdges {
+		polarity = board.RisingEdge
+		if tb.DigitalRead(pin) {
+			polarity = board.FallingEdge
+		}
+	}
+	setPolarity(regs, bit, polarity)
+	regs[GPIO_PORTA_EOF_OFFSET/4] = bit
+	regs[GPIO_INTEN_OFFSET/4] |= bit
+	mu.Unlock()
+
+	c := make(chan board.EdgeEvent, 1)
+	go func() {
+		defer close(c)
+		defer func() {
+			mu.Lock()
+			regs[GPIO_INTEN_OFFSET/4] &= ^bit
+			mu.Unlock()
+		}()
+		t := time.NewTicker(board.EdgePollInterval)
+		defer t.Stop()
+		var last time.Time
+		for {
+			var now time.Time
+			select {
+			case <-ctx.Done():
+				return
+			case now = <-t.C:
+			}
+			mu.Lock()
+			if regs[GPIO_INT_RAWSTATUS_OFFSET/4]&bit == 0 {
+				mu.Unlock()
+				continue
+			}
+			regs[GPIO_PORTA_EOF_OFFSET/4] = bit
+			ev := board.EdgeEvent{Pin: pin, Edge: polarity, Time: now}
+			if edge == board.BothEdges {
+				if polarity == board.RisingEdge {
+					polarity = board.FallingEdge
+				} else {
+					polarity = board.RisingEdge
+				}
+				setPolarity(regs, bit, polarity)
+			}
+			mu.Unlock()
+			if debounce > 0 && !last.IsZero() && now.Sub(last) < debounce {
+				continue
+			}
+			last = now
+			select {
+			case c <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// SetPWM muxes pin to its PWM function and outputs the signal with the RK3288
+// PWM controller. Only GPIO7_C6 (PWM2) and GPIO7_C7 (PWM3) can be used. A
+// zero period disables the channel, the pin staying muxed to PWM until its
+// next SetPinMode.
+func (tb *TinkerBoard) SetPWM(pin int, period, duty time.Duration) error {
+	ch, ok := pwmChannels[pin]
+	if !ok {
+		return fmt.Errorf("tinkerboard: pin %d has no pwm function", pin)
+	}
+	if period < 0 || duty < 0 || duty > period {
+		return fmt.Errorf("tinkerboard: invalid pwm period %v and duty %v", period, duty)
+	}
+	periodCnt := int64(period) * pwmClkRate / int64(time.Second)
+	if periodCnt > math.MaxUint32 {
+		return fmt.Errorf("tinkerboard: pwm period %v too long", period)
+	}
+	dutyCnt := int64(duty) * pwmClkRate / int64(time.Second)
+
+	regs := tb.pwm[ch*PWM_CHANNEL_LEN/4:]
+	regs[PWM_CTRL_OFFSET/4] &= ^uint32(pwmCtrlEnable)
+	if period == 0 {
+		return nil
+	}
+	tb.grf[GRF_SOC_CON2/4] = grfSocCon2PWMSel<<16 | grfSocCon2PWMSel
+	bank, _ := gpioToBank(pin)
+	tb.bankMu[bank].Lock()
+	defer tb.bankMu[bank].Unlock()
+	p := uint32(pin)
+	tb.grf[GRF_GPIO7CH_IOMUX/4] = (tb.grf[GRF_GPIO7CH_IOMUX/4]|(0x0f<<(16+(p%8-4)*4)))&(^(0x0f << ((p%8 - 4) * 4))) | pwmIOMux<<((p%8-4)*4)
+	regs[PWM_PERIOD_HPR_OFFSET/4] = uint32(periodCnt)
+	regs[PWM_DUTY_LPR_OFFSET/4] = uint32(dutyCnt)
+	regs[PWM_CNT_OFFSET/4] = 0
+	regs[PWM_CTRL_OFFSET/4] = pwmCtrlContinuous | pwmCtrlDutyPositive | pwmCtrlEnable
+	return nil
+}
+
+// SetPull sets the pull resistor of a GPIO pin.
+func (tb *TinkerBoard) SetPull(pin int, pull board.Pull) error {
+	var v uint32
+	switch pull {
+	case board.PullNone:
+		v = pullZ
+	case board.PullUp:
+		v = pullUp
+	case board.PullDown:
+		v = pullDown
+	default:
+		return fmt.Errorf("tinkerboard: invalid pull %d", pull)
+	}
+	if err := board.CheckPin(tb, pin); err != nil {
+		return fmt.Errorf("tinkerboard: %w", err)
+	}
+	bank, _ := gpioToBank(pin)
+	tb.bankMu[bank].Lock()
+	defer tb.bankMu[bank].Unlock()
+	regs, reg := tb.pinConfigReg(pin, PMU_GPIO0A_P, GRF_GPIO1A_P)
+	tb.writeConfigBits(regs, reg, pin, v)
+	return nil
+}
+
+// SetDriveStrength sets the drive strength of a GPIO pin, either 2, 4, 8 or
+// 12mA.
+func (tb *TinkerBoard) SetDriveStrength(pin int, ds board.DriveStrength) error {
+	v, ok := driveStrengths[ds]
+	if !ok {
+		return fmt.Errorf("tinkerboard: unsupported drive strength %dmA", ds)
+	}
+	if err := board.CheckPin(tb, pin); err != nil {
+		return fmt.Errorf("tinkerboard: %w", err)
+	}
+	bank, _ := gpioToBank(pin)
+	tb.bankMu[bank].Lock()
+	defer tb.bankMu[bank].Unlock()
+	regs, reg := tb.pinConfigReg(pin, PMU_GPIO0A_E, GRF_GPIO1A_E)
+	tb.writeConfigBits(regs, reg, pin, v)
+	return nil
+}
+
+// pinConfigReg returns the registers block and the index of the pull or
+// drive strength register of pin, given the GPIO0A one in the PMU and the
+// GPIO1A one in the GRF.
+func (tb *TinkerBoard) pinConfigReg(pin int, pmuOffset, grfOffset uint32) ([]uint32, uint32) {
+	bank, bankPin := gpioToBank(pin)
+	port := bankPin / 8
+	if bank == 0 {
+		return tb.pmu, pmuOffset/4 + port
+	}
+	return tb.grf, grfOffset/4 + (bank-1)*4 + port
+}
+
+// writeConfigBits writes the 2 bits of pin in a pull or drive strength
+// register, the upper half being the write enable mask.
+func (tb *TinkerBoard) writeConfigBits(regs []uint32, reg uint32, pin int, v uint32) {
+	_, bankPin := gpioToBank(pin)
+	shift := (bankPin % 8) * 2
+	regs[reg] = (regs[reg]|(0x03<<(shift+16)))&(^(0x03 << shift)) | v<<shift
+}
+
 func (tb *TinkerBoard) gpioClkEnable() {
 	tb.cru[CRU_CLKGATE17_CON/4] = (tb.cru[CRU_CLKGATE17_CON/4] & (^uint32(1 << 4))) | (1 << (16 + 4))
 	for bank := uint32(1); bank < gpioBankLen; bank++ {
@@ -167,7 +368,7 @@ func (tb *TinkerBoard) writeMaskedBits(bank, value, mask uint32) {
 	tb.gpio[bank][GPIO_SWPORTA_DR_OFFSET/4] = tb.gpio[bank][GPIO_SWPORTA_DR_OFFSET/4] & ^(^value&mask) | value
 }
 
-func (tb *TinkerBoard) setGPIOPinMode(pin int) {
+func (tb *TinkerBoard) setGPIOPinMode(pin int) error {
 	p := uint32(pin)
 	switch p {
 	//GPIO0
@@ -183,7 +384,6 @@ func (tb *TinkerBoard) setGPIOPinMode(pin int) {
 	//GPIO6A
 	case GPIO6_A1:
 		tb.grf[GRF_GPIO6A_IOMUX/4] = (tb.grf[GRF_GPIO6A_IOMUX/4] | (0x0f << ((p%8)*2 + 16))) & (^(0x0f << ((p % 8) * 2)))
-		// tb.grf[GRF_GPIO6A_P/4] = ((tb.grf[GRF_GPIO6A_P/4] | (0x03 << (((GPIO6_A2)%8)*2 + 16))) & (^(0x03 << (((GPIO6_A2) % 8) * 2)))) | (0 << (((GPIO6_A2)%8)*2 + 1)) | (0 << (((GPIO6_A2) % 8) * 2))
 	case GPIO6_A0, GPIO6_A3, GPIO6_A4:
 		tb.grf[GRF_GPIO6A_IOMUX/4] = (tb.grf[GRF_GPIO6A_IOMUX/4] | (0x03 << ((p%8)*2 + 16))) & (^(0x03 << ((p % 8) * 2)))
 	//GPIO7A7
@@ -203,6 +403,17 @@ func (tb *TinkerBoard) setGPIOPinMode(pin int) {
 	//GPIO8B
 	case GPIO8_B0, GPIO8_B1:
 		tb.grf[GRF_GPIO8B_IOMUX/4] = (tb.grf[GRF_GPIO8B_IOMUX/4] | (0x03 << ((p%8)*2 + 16))) & (^(0x03 << ((p % 8) * 2)))
+	default:
+		return fmt.Errorf("tinkerboard: unable to mux pin to gpio: %w", board.InvalidPinError(pin))
+	}
+	return nil
+}
+
+func setPolarity(regs []uint32, bit uint32, edge board.Edge) {
+	if edge == board.RisingEdge {
+		regs[GPIO_INT_POLARITY_OFFSET/4] |= bit
+	} else {
+		regs[GPIO_INT_POLARITY_OFFSET/4] &= ^bit
 	}
 }
 
@@ -213,13 +424,6 @@ func gpioToBank(gpio int) (uint32, uint32) {
 	return uint32(((gpio - 24) / 32) + 1), uint32((gpio - 24) % 32)
 }
 
-func mapToUInt32Slice(m []byte) []uint32 {
-	h := (*reflect.SliceHeader)(unsafe.Pointer(&m))
-	h.Len /= 4
-	h.Cap /= 4
-	return *(*[]uint32)(unsafe.Pointer(h))
-}
-
 type BankWriter struct {
 	offsets []bankWriterOffset
 	data    [gpioBankLen]struct {
@@ -241,6 +445,9 @@ func NewBankWriter(pins []int) *BankWriter {
 	}
 	for i, pin := range pins {
 		bank, bankPin := gpioToBank(pin)
+		if bank >= gpioBankLen {
+			continue
+		}
 		bitPin := uint32(1 << bankPin)
 		bw.offsets[i].bank = bank
 		bw.offsets[i].bitPin = bitPin
@@ -265,3 +472,12 @@ func (bw *BankWriter) Set(val uint32) {
 		}
 	}
 }
+
+type bankPinWriter struct {
+	*BankWriter
+	tb *TinkerBoard
+}
+
+func (pw *bankPinWriter) Write() {
+	pw.tb.PerfWrites(pw.BankWriter)
+}
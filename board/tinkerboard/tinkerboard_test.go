@@ -1,7 +1,10 @@
 package tinkerboard_test
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/post-l/hw/board"
 	"github.com/post-l/hw/board/tinkerboard"
@@ -34,7 +37,9 @@ func TestBoard(t *testing.T) {
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
 			pin := tc.pin
-			tb.SetPinMode(pin, board.Output)
+			if err := tb.SetPinMode(pin, board.Output); err != nil {
+				t.Fatalf("expect SetPinMode to return no error: %v", err)
+			}
 			tb.DigitalWrite(pin, true)
 			if got, want := tb.DigitalRead(pin), true; got != want {
 				t.Errorf("invalid digital read value: got %v; want %v", got, want)
@@ -46,3 +51,304 @@ func TestBoard(t *testing.T) {
 		})
 	}
 }
+
+// memory maps zeroed registers, kept by address for inspection.
+type memory struct {
+	blocks map[int64][]uint32
+	closed bool
+}
+
+func (m *memory) Map(offset int64, length int) ([]uint32, error) {
+	if m.blocks == nil {
+		m.blocks = make(map[int64][]uint32)
+	}
+	m.blocks[offset] = make([]uint32, length/4)
+	return m.blocks[offset], nil
+}
+
+func (m *memory) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestRegisters(t *testing.T) {
+	const (
+		grf   = tinkerboard.RK3288_GRF_PHYS
+		pmu   = tinkerboard.RK3288_PMU
+		cru   = tinkerboard.RK3288_CRU
+		gpio0 = 0xff750000
+		gpio5 = 0xff7c0000
+		gpio7 = 0xff7e0000
+	)
+	mem := &memory{}
+	tb, err := tinkerboard.NewWithMemory(mem)
+	if err != nil {
+		t.Fatalf("expect NewWithMemory to return no error: %v", err)
+	}
+	if got, want := len(mem.blocks), 13; got != want {
+		t.Fatalf("invalid number of mapped blocks: got %d; want %d", got, want)
+	}
+
+	reg := func(block int64, offset int) *uint32 {
+		regs, ok := mem.blocks[block]
+		if !ok {
+			t.Fatalf("block %#x not mapped", block)
+		}
+		return &regs[offset/4]
+	}
+	tt := []struct {
+		name  string
+		block int64
+		reg   int
+		want  uint32
+	}{
+		// gpioClkEnable
+		{"CRU_CLKGATE17_CON", cru, tinkerboard.CRU_CLKGATE17_CON, 1 << 20},
+		{"CRU_CLKGATE14_CON", cru, tinkerboard.CRU_CLKGATE14_CON, 0xff << 17},
+	}
+	check := func() {
+		for _, tc := range tt {
+			if got := *reg(tc.block, tc.reg); got != tc.want {
+				t.Errorf("invalid %s register: got %#08x; want %#08x", tc.name, got, tc.want)
+			}
+		}
+	}
+	check()
+
+	*reg(gpio5, tinkerboard.GPIO_SWPORTA_DR_OFFSET) = 1<<2 | 1<<4
+	for _, pin := range []int{tinkerboard.GPIO0_C1, tinkerboard.GPIO5_B4, tinkerboard.GPIO5_B5} {
+		if err := tb.SetPinMode(pin, board.Output); err != nil {
+			t.Fatalf("expect SetPinMode to return no error: %v", err)
+		}
+	}
+	if err := tb.SetPinMode(tinkerboard.GPIO7_C6, board.Input); err != nil {
+		t.Fatalf("expect SetPinMode to return no error: %v", err)
+	}
+	tb.DigitalWrites([]board.PinValue{
+		{Pin: tinkerboard.GPIO5_B4, Value: true},
+		{Pin: tinkerboard.GPIO5_B5, Value: true},
+		{Pin: tinkerboard.GPIO0_C1, Value: true},
+	})
+	tb.DigitalWrite(tinkerboard.GPIO5_B4, false)
+	tt = []struct {
+		name  string
+		block int64
+		reg   int
+		want  uint32
+	}{
+		// setGPIOPinMode, the upper half being the write enable mask.
+		{"PMU_GPIO0C_IOMUX", pmu, tinkerboard.PMU_GPIO0C_IOMUX, 3 << 18},
+		{"GRF_GPIO5B_IOMUX", grf, tinkerboard.GRF_GPIO5B_IOMUX, 3<<24 | 3<<26},
+		{"GRF_GPIO7CH_IOMUX", grf, tinkerboard.GRF_GPIO7CH_IOMUX, 0xf << 24},
+		{"GPIO0 DDR", gpio0, tinkerboard.GPIO_SWPORTA_DDR_OFFSET, 1 << 17},
+		{"GPIO5 DDR", gpio5, tinkerboard.GPIO_SWPORTA_DDR_OFFSET, 1<<12 | 1<<13},
+		{"GPIO7 DDR", gpio7, tinkerboard.GPIO_SWPORTA_DDR_OFFSET, 0},
+		// DigitalWrites and DigitalWrite
+		{"GPIO0 DR", gpio0, tinkerboard.GPIO_SWPORTA_DR_OFFSET, 1 << 17},
+		{"GPIO5 DR", gpio5, tinkerboard.GPIO_SWPORTA_DR_OFFSET, 1<<2 | 1<<4 | 1<<13},
+	}
+	check()
+
+	tb.Close()
+	if !mem.closed {
+		t.Error("expect Close to close the memory")
+	}
+}
+
+func TestInvalidPin(t *testing.T) {
+	tb, err := tinkerboard.NewWithMemory(&memory{})
+	if err != nil {
+		t.Fatalf("expect NewWithMemory to return no error: %v", err)
+	}
+	defer tb.Close()
+	for _, pin := range []int{-1, tinkerboard.GPIO6_A2, 1000} {
+		if err := tb.SetPinMode(pin, board.Output); !errors.Is(err, board.ErrInvalidPin) {
+			t.Errorf("invalid SetPinMode(%d) error: got %v; want %v", pin, err, board.ErrInvalidPin)
+		}
+		if err := board.CheckPin(tb, pin); !errors.Is(err, board.ErrInvalidPin) {
+			t.Errorf("invalid CheckPin(%d) error: got %v; want %v", pin, err, board.ErrInvalidPin)
+		}
+		tb.DigitalWrite(pin, true)
+	}
+	if err := board.CheckPin(tb, tinkerboard.GPIO8_B1); err != nil {
+		t.Errorf("expect CheckPin to return no error: %v", err)
+	}
+}
+
+func TestPinConfig(t *testing.T) {
+	mem := &memory{}
+	tb, err := tinkerboard.NewWithMemory(mem)
+	if err != nil {
+		t.Fatalf("expect NewWithMemory to return no error: %v", err)
+	}
+	defer tb.Close()
+	grf := mem.blocks[tinkerboard.RK3288_GRF_PHYS]
+	pmu := mem.blocks[tinkerboard.RK3288_PMU]
+
+	if err := tb.SetPull(tinkerboard.GPIO5_B4, board.PullUp); err != nil {
+		t.Fatalf("expect SetPull to return no error: %v", err)
+	}
+	if got, want := grf[0x0184/4], uint32(3<<24|1<<8); got != want {
+		t.Errorf("invalid GRF_GPIO5B_P register: got %#08x; want %#08x", got, want)
+	}
+	if err := tb.SetPull(tinkerboard.GPIO0_C1, board.PullDown); err != nil {
+		t.Fatalf("expect SetPull to return no error: %v", err)
+	}
+	if got, want := pmu[0x006c/4], uint32(3<<18|2<<2); got != want {
+		t.Errorf("invalid PMU_GPIO0C_P register: got %#08x; want %#08x", got, want)
+	}
+	if err := tb.SetDriveStrength(tinkerboard.GPIO7_C6, 12); err != nil {
+		t.Fatalf("expect SetDriveStrength to return no error: %v", err)
+	}
+	if got, want := grf[0x0228/4], uint32(3<<28|3<<12); got != want {
+		t.Errorf("invalid GRF_GPIO7C_E register: got %#08x; want %#08x", got, want)
+	}
+
+	if err := tb.SetDriveStrength(tinkerboard.GPIO7_C6, 5); err == nil {
+		t.Error("expect SetDriveStrength to return an error for 5mA")
+	}
+	if err := tb.SetPull(tinkerboard.GPIO6_A2, board.PullUp); !errors.Is(err, board.ErrInvalidPin) {
+		t.Errorf("invalid SetPull error: got %v; want %v", err, board.ErrInvalidPin)
+	}
+}
+
+func TestWatchEdges(t *testing.T) {
+	const gpio5 = 0xff7c0000
+	mem := &memory{}
+	tb, err := tinkerboard.NewWithMemory(mem)
+	if err != nil {
+		t.Fatalf("expect NewWithMemory to return no error: %v", err)
+	}
+	defer tb.Close()
+	regs := mem.blocks[gpio5]
+	const bit = 1 << 12 // GPIO5_B4
+
+	// The edge is detected before watching.
+	regs[tinkerboard.GPIO_INT_RAWSTATUS_OFFSET/4] = bit
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := tb.WatchEdges(ctx, tinkerboard.GPIO5_B4, board.BothEdges, time.Millisecond)
+	if err != nil {
+		t.Fatalf("expect WatchEdges to return no error: %v", err)
+	}
+	tt := []struct {
+		name string
+		reg  int
+		want uint32
+	}{
+		{"GPIO_INTEN", tinkerboard.GPIO_INTEN_OFFSET, bit},
+		{"GPIO_INTMASK", tinkerboard.GPIO_INTMASK_OFFSET, bit},
+		{"GPIO_INTTYPE_LEVEL", tinkerboard.GPIO_INTTYPE_LEVEL_OFFSET, bit},
+		{"GPIO_DEBOUNCE", tinkerboard.GPIO_DEBOUNCE_OFFSET, bit},
+		{"GPIO_SWPORTA_DDR", tinkerboard.GPIO_SWPORTA_DDR_OFFSET, 0},
+	}
+	for _, tc := range tt {
+		if got := regs[tc.reg/4]; got != tc.want {
+			t.Errorf("invalid %s register: got %#08x; want %#08x", tc.name, got, tc.want)
+		}
+	}
+
+	// The pin being low, the rising edge is detected first.
+	ev := <-c
+	if ev.Pin != tinkerboard.GPIO5_B4 || ev.Edge != board.RisingEdge {
+		t.Errorf("invalid event: %+v", ev)
+	}
+	cancel()
+	for range c {
+	}
+	if got, want := regs[tinkerboard.GPIO_INTEN_OFFSET/4], uint32(0); got != want {
+		t.Errorf("invalid GPIO_INTEN register after cancel: got %#08x; want %#08x", got, want)
+	}
+	if got, want := regs[tinkerboard.GPIO_PORTA_EOF_OFFSET/4], uint32(bit); got != want {
+		t.Errorf("invalid GPIO_PORTA_EOI register: got %#08x; want %#08x", got, want)
+	}
+}
+
+func TestWatchEdgesSameBank(t *testing.T) {
+	const gpio5 = 0xff7c0000
+	mem := &memory{}
+	tb, err := tinkerboard.NewWithMemory(mem)
+	if err != nil {
+		t.Fatalf("expect NewWithMemory to return no error: %v", err)
+	}
+	defer tb.Close()
+	regs := mem.blocks[gpio5]
+	pins := []int{tinkerboard.GPIO5_B0, tinkerboard.GPIO5_B1, tinkerboard.GPIO5_B2}
+	// The edges keep being detected, the watchers flipping their polarity
+	// on each poll.
+	regs[tinkerboard.GPIO_INT_RAWSTATUS_OFFSET/4] = 0x0700
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var cs []<-chan board.EdgeEvent
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			tb.SetPinMode(tinkerboard.GPIO5_B3, board.Output)
+		}
+	}()
+	for _, pin := range pins {
+		c, err := tb.WatchEdges(ctx, pin, board.BothEdges, 0)
+		if err != nil {
+			t.Fatalf("expect WatchEdges to return no error: %v", err)
+		}
+		cs = append(cs, c)
+	}
+	<-done
+	for _, c := range cs {
+		<-c
+	}
+	cancel()
+	for _, c := range cs {
+		for range c {
+		}
+	}
+	if got, want := regs[tinkerboard.GPIO_INTEN_OFFSET/4], uint32(0); got != want {
+		t.Errorf("invalid GPIO_INTEN register: got %#08x; want %#08x", got, want)
+	}
+	if got, want := regs[tinkerboard.GPIO_SWPORTA_DDR_OFFSET/4], uint32(1<<11); got != want {
+		t.Errorf("invalid GPIO_SWPORTA_DDR register: got %#08x; want %#08x", got, want)
+	}
+}
+
+func TestPWM(t *testing.T) {
+	mem := &memory{}
+	tb, err := tinkerboard.NewWithMemory(mem)
+	if err != nil {
+		t.Fatalf("expect NewWithMemory to return no error: %v", err)
+	}
+	defer tb.Close()
+	grf := mem.blocks[tinkerboard.RK3288_GRF_PHYS]
+	pwm := mem.blocks[tinkerboard.RK3288_PWM]
+
+	if err := tb.SetPWM(tinkerboard.GPIO7_C7, time.Millisecond, 250*time.Microsecond); err != nil {
+		t.Fatalf("expect SetPWM to return no error: %v", err)
+	}
+	pwm3 := 3 * tinkerboard.PWM_CHANNEL_LEN
+	tt := []struct {
+		name string
+		regs []uint32
+		reg  int
+		want uint32
+	}{
+		{"GRF_SOC_CON2", grf, tinkerboard.GRF_SOC_CON2, 1<<16 | 1},
+		{"GRF_GPIO7CH_IOMUX", grf, tinkerboard.GRF_GPIO7CH_IOMUX, 0xf<<28 | 3<<12},
+		{"PWM3_PERIOD_HPR", pwm, pwm3 + tinkerboard.PWM_PERIOD_HPR_OFFSET, 74250},
+		{"PWM3_DUTY_LPR", pwm, pwm3 + tinkerboard.PWM_DUTY_LPR_OFFSET, 18562},
+		{"PWM3_CTRL", pwm, pwm3 + tinkerboard.PWM_CTRL_OFFSET, 0x0b},
+	}
+	for _, tc := range tt {
+		if got := tc.regs[tc.reg/4]; got != tc.want {
+			t.Errorf("invalid %s register: got %#08x; want %#08x", tc.name, got, tc.want)
+		}
+	}
+
+	if err := tb.SetPWM(tinkerboard.GPIO7_C7, 0, 0); err != nil {
+		t.Fatalf("expect SetPWM to return no error: %v", err)
+	}
+	if got, want := pwm[(pwm3+tinkerboard.PWM_CTRL_OFFSET)/4], uint32(0x0a); got != want {
+		t.Errorf("invalid PWM3_CTRL register after stop: got %#08x; want %#08x", got, want)
+	}
+	if err := tb.SetPWM(tinkerboard.GPIO5_B4, time.Millisecond, 0); err == nil {
+		t.Error("expect SetPWM to return an error for a pin without pwm")
+	}
+}
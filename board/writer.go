@@ -0,0 +1,49 @@
+package board
+
+// PinWriter writes a fixed set of pins at once. It is meant for hot paths,
+// like the matrix scan loop, where the written pins are known in advance.
+type PinWriter interface {
+	// Set sets the pending pin values from the bits of val, the i-th bit
+	// being the value of the i-th pin.
+	Set(val uint32)
+	// Write writes the pending pin values to the board.
+	Write()
+}
+
+// PinWriterBoard is implemented by boards providing a faster PinWriter than
+// the DigitalWrites based one returned by NewPinWriter.
+type PinWriterBoard interface {
+	Board
+	NewPinWriter(pins []int) PinWriter
+}
+
+// NewPinWriter returns a PinWriter for the given pins, at most 32. It uses the
+// board fast path if it implements PinWriterBoard.
+func NewPinWriter(b Board, pins []int) PinWriter {
+	if pwb, ok := b.(PinWriterBoard); ok {
+		return pwb.NewPinWriter(pins)
+	}
+	pw := &pinWriter{
+		b:   b,
+		pvs: make([]PinValue, len(pins)),
+	}
+	for i, pin := range pins {
+		pw.pvs[i].Pin = pin
+	}
+	return pw
+}
+
+type pinWriter struct {
+	b   Board
+	pvs []PinValue
+}
+
+func (pw *pinWriter) Set(val uint32) {
+	for i := range pw.pvs {
+		pw.pvs[i].Value = val&(1<<uint32(i)) != 0
+	}
+}
+
+func (pw *pinWriter) Write() {
+	pw.b.DigitalWrites(pw.pvs)
+}
@@ -19,7 +19,7 @@ import (
 
 type pwmBitser interface {
 	PWMBits() int
-	SetPWMBits(pwmBits int)
+	SetPWMBits(pwmBits int) error
 }
 
 func main() {
@@ -62,8 +62,9 @@ func randTextAnim(ctx context.Context, m toolkit.Matrix, tk *toolkit.ToolKit, ta
 		return
 	}
 	if v, ok := m.(pwmBitser); ok {
-		defer v.SetPWMBits(v.PWMBits())
-		v.SetPWMBits(3)
+		if prev := v.PWMBits(); v.SetPWMBits(3) == nil {
+			defer v.SetPWMBits(prev)
+		}
 	}
 	tk.PlayAnimation(ctx, ta)
 }
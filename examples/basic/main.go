@@ -26,11 +26,15 @@ func run(m toolkit.Matrix) error {
 		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 			m.Set(x, y, c)
 		}
-		m.Render()
+		if err := m.Render(); err != nil {
+			return err
+		}
 		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 			m.Set(x, y, c)
 		}
-		m.Render()
+		if err := m.Render(); err != nil {
+			return err
+		}
 		if d := 150*time.Millisecond - time.Since(t); d > 0 {
 			time.Sleep(d)
 		}
@@ -2,10 +2,13 @@ package examples
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"math/rand"
 	"time"
 
+	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/rpi"
 	"github.com/post-l/hw/board/tinkerboard"
 	"github.com/post-l/hw/matrix"
 	"github.com/post-l/hw/matrix/emulator"
@@ -13,14 +16,27 @@ import (
 )
 
 var (
-	emFlag = flag.Bool("emulator", false, "use emulator")
+	emFlag          = flag.Bool("emulator", false, "use emulator")
+	boardFlag       = flag.String("board", "tinkerboard", "board: tinkerboard or rpi")
+	configFlag      = flag.String("led-config", "", "hardware config file: .json or flat key/value .conf")
+	showRefreshFlag = flag.Bool("led-show-refresh", false, "log the refresh rate every second")
+
+	flagConfig = matrix.DefaultHardwareConfig
 )
 
+func init() {
+	matrix.RegisterFlags(flag.CommandLine, &flagConfig)
+}
+
 func Main(run func(toolkit.Matrix) error) {
 	flag.Parse()
 	rand.Seed(time.Now().UnixNano())
+	hc, err := hardwareConfig()
+	if err != nil {
+		log.Fatal("config:", err)
+	}
 	if *emFlag {
-		m := emulator.NewEmulator(&matrix.DefaultHardwareConfig)
+		m := emulator.NewEmulator(hc)
 		go func() {
 			if err := run(m); err != nil {
 				log.Println("run:", err)
@@ -29,14 +45,56 @@ func Main(run func(toolkit.Matrix) error) {
 		}()
 		m.Run()
 	} else {
-		b, err := tinkerboard.New()
+		b, err := newBoard(*boardFlag)
 		if err != nil {
 			log.Fatal("board:", err)
 		}
-		m := matrix.New(b, &matrix.DefaultHardwareConfig)
+		hc.CloseBoard = true
+		if *showRefreshFlag {
+			hc.StatsFunc = func(s matrix.Stats) {
+				log.Printf("matrix: %.1f Hz", s.RefreshRate)
+			}
+		}
+		m, err := matrix.New(b, hc)
+		if err != nil {
+			log.Fatal("matrix:", err)
+		}
 		defer m.Close()
 		if err := run(m); err != nil {
 			log.Fatal("run:", err)
 		}
 	}
 }
+
+// hardwareConfig returns the config loaded from -led-config, if any, with
+// the flags explicitly set on the command line applied over it.
+func hardwareConfig() (*matrix.HardwareConfig, error) {
+	hc := &flagConfig
+	if *configFlag != "" {
+		var err error
+		if hc, err = matrix.LoadConfig(*configFlag); err != nil {
+			return nil, err
+		}
+		fs := flag.NewFlagSet("", flag.ContinueOnError)
+		matrix.RegisterFlags(fs, hc)
+		flag.Visit(func(f *flag.Flag) {
+			if err == nil && fs.Lookup(f.Name) != nil {
+				err = fs.Set(f.Name, f.Value.String())
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hc, hc.Validate()
+}
+
+func newBoard(name string) (board.Board, error) {
+	switch name {
+	case "tinkerboard":
+		return tinkerboard.New()
+	case "rpi":
+		return rpi.New()
+	}
+	return nil, fmt.Errorf("unknown board %q", name)
+}
@@ -0,0 +1,421 @@
+package matrix
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configField is a HardwareConfig field settable from a config file key or a
+// command line flag.
+type configField struct {
+	key   string
+	flag  string
+	usage string
+	value func(hc *HardwareConfig) flag.Value
+}
+
+var configFields = []configField{
+	{"rows", "led-rows", "number of rows of the panel", func(hc *HardwareConfig) flag.Value { return (*intValue)(&hc.Rows) }},
+	{"cols", "led-cols", "number of columns of the panel", func(hc *HardwareConfig) flag.Value { return (*intValue)(&hc.Cols) }},
+	{"chain_length", "led-chain", "number of daisy-chained panels", func(hc *HardwareConfig) flag.Value { return (*intValue)(&hc.ChainLength) }},
+	{"parallel", "led-parallel", "number of parallel chains, 1..3", func(hc *HardwareConfig) flag.Value { return (*intValue)(&hc.Parallel) }},
+	{"pwm_bits", "led-pwm-bits", "PWM bits, 1..11", func(hc *HardwareConfig) flag.Value { return (*intValue)(&hc.PWMBits) }},
+	{"brightness", "led-brightness", "brightness in percent, 1..100", func(hc *HardwareConfig) flag.Value { return (*intValue)(&hc.Brightness) }},
+	{"scan_mode", "led-scan-mode", "scan mode, progressive or interlaced", func(hc *HardwareConfig) flag.Value { return (*scanModeValue)(&hc.ScanMode) }},
+	{"panel_type", "led-panel-type", "panel driver chip needing an initialization: FM6126A or FM6127", func(hc *HardwareConfig) flag.Value { return (*panelTypeValue)(&hc.PanelType) }},
+	{"row_addr_type", "led-row-addr-type", "row address type: direct, abc-shift or direct-row-select", func(hc *HardwareConfig) flag.Value { return (*rowAddressTypeValue)(&hc.RowAddressType) }},
+	{"multiplexing", "led-multiplexing", "multiplexing of outdoor panels", func(hc *HardwareConfig) flag.Value { return &multiplexerValue{mux: &hc.Multiplexer} }},
+	{"pixel_mapper", "led-pixel-mapper", "semicolon separated pixel mappers, like U-mapper;Rotate:90", func(hc *HardwareConfig) flag.Value { return &pixelMapperValue{pms: &hc.PixelMappers} }},
+	{"hardware_mapping", "led-gpio-mapping", "hardware mapping name", func(hc *HardwareConfig) flag.Value { return &mappingValue{hm: &hc.Mapping} }},
+	{"buffering", "led-buffering", "buffering: double or triple", func(hc *HardwareConfig) flag.Value { return (*bufferingValue)(&hc.Buffering) }},
+}
+
+// RegisterFlags defines on fs a flag per HardwareConfig field, like
+// -led-rows, setting hc and defaulting to its values. The flags are not
+// validated, call hc.Validate after parsing them.
+func RegisterFlags(fs *flag.FlagSet, hc *HardwareConfig) {
+	for _, f := range configFields {
+		usage := f.usage
+		switch f.key {
+		case "hardware_mapping":
+			usage += ": " + strings.Join(HardwareMappingNames(), ", ")
+		case "multiplexing":
+			usage += ": " + strings.Join(MultiplexerNames(), ", ")
+		}
+		fs.Var(f.value(hc), f.flag, usage)
+	}
+}
+
+// LoadConfig loads a HardwareConfig from a JSON file, or from a flat
+// key/value .conf file. Fields missing from the file keep their
+// DefaultHardwareConfig value and the mapping is given by name.
+//
+// Flat key/value files hold a key and its value per line, separated by =,
+// with # starting comments, like:
+//
+//	rows = 32
+//	hardware_mapping = "tinkerboard-default" # comment
+//
+// Values may be double quoted, taking Go escapes, to hold a #.
+//
+// Errors are prefixed with the path, and with the line when it is known.
+func LoadConfig(path string) (*HardwareConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kvs []keyValue
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		kvs, err = parseJSON(data)
+	case ".conf":
+		kvs, err = parseKeyValues(data)
+	default:
+		return nil, fmt.Errorf("matrix: unsupported config file extension %q, must be .json or .conf", ext)
+	}
+	if err != nil {
+		return nil, &configError{path: path, err: err}
+	}
+	hc := DefaultHardwareConfig
+	for _, kv := range kvs {
+		if err := hc.set(kv.key, kv.value); err != nil {
+			return nil, &configError{path: path, err: fmt.Errorf("line %d: %w", kv.line, err)}
+		}
+	}
+	if err := hc.Validate(); err != nil {
+		return nil, &configError{path: path, err: err}
+	}
+	return &hc, nil
+}
+
+// configError is an error loading the config file at path.
+type configError struct {
+	path string
+	err  error
+}
+
+func (e *configError) Error() string {
+	return fmt.Sprintf("matrix: %s: %s", e.path, strings.TrimPrefix(e.err.Error(), "matrix: "))
+}
+
+func (e *configError) Unwrap() error { return e.err }
+
+func (hc *HardwareConfig) set(key, value string) error {
+	for _, f := range configFields {
+		if f.key == key {
+			if err := f.value(hc).Set(value); err != nil {
+				return fmt.Errorf("invalid %s: %w", key, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key %q", key)
+}
+
+type keyValue struct {
+	line       int
+	key, value string
+}
+
+// parseJSON parses a JSON object of config keys, strings being unquoted and
+// other values kept as written.
+func parseJSON(data []byte) ([]keyValue, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := d.Token(); err != nil {
+		return nil, jsonError(data, d, err)
+	} else if tok != json.Delim('{') {
+		return nil, fmt.Errorf("line %d: expected an object", lineAt(data, d.InputOffset()))
+	}
+	var kvs []keyValue
+	seen := make(map[string]bool)
+	for d.More() {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, jsonError(data, d, err)
+		}
+		key := tok.(string)
+		line := lineAt(data, d.InputOffset())
+		var raw json.RawMessage
+		if err := d.Decode(&raw); err != nil {
+			return nil, jsonError(data, d, err)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line, key)
+		}
+		seen[key] = true
+		v := string(raw)
+		if s, err := strconv.Unquote(v); err == nil {
+			v = s
+		}
+		kvs = append(kvs, keyValue{line: line, key: key, value: v})
+	}
+	if _, err := d.Token(); err != nil {
+		return nil, jsonError(data, d, err)
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, fmt.Errorf("line %d: unexpected data after the object", lineAt(data, d.InputOffset()))
+	}
+	return kvs, nil
+}
+
+// jsonError prefixes err with the line it occurred at.
+func jsonError(data []byte, d *json.Decoder, err error) error {
+	offset := d.InputOffset()
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		offset = se.Offset
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("line %d: %w", lineAt(data, offset), err)
+}
+
+// lineAt returns the line, from 1, holding the byte at offset.
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return 1 + bytes.Count(data[:offset], []byte("\n"))
+}
+
+// parseKeyValues parses the key = value lines of a flat key/value file.
+func parseKeyValues(data []byte) ([]keyValue, error) {
+	var kvs []keyValue
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		v, err := parseValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		kvs = append(kvs, keyValue{line: n, key: key, value: v})
+	}
+	return kvs, s.Err()
+}
+
+// parseValue parses a double quoted or bare value followed by an optional
+// comment.
+func parseValue(v string) (string, error) {
+	if v == "" || v[0] != '"' {
+		if i := strings.IndexByte(v, '#'); i >= 0 {
+			v = strings.TrimSpace(v[:i])
+		}
+		return v, nil
+	}
+	end := 1
+	for ; end < len(v) && v[end] != '"'; end++ {
+		if v[end] == '\\' {
+			end++
+		}
+	}
+	if end >= len(v) {
+		return "", errors.New("unterminated string")
+	}
+	s, err := strconv.Unquote(v[:end+1])
+	if err != nil {
+		return "", fmt.Errorf("invalid string %s", v[:end+1])
+	}
+	if rest := strings.TrimSpace(v[end+1:]); rest != "" && rest[0] != '#' {
+		return "", fmt.Errorf("unexpected %q after string", rest)
+	}
+	return s, nil
+}
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v = intValue(n)
+	return nil
+}
+
+func (v *intValue) String() string {
+	if v == nil {
+		return "0"
+	}
+	return strconv.Itoa(int(*v))
+}
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string {
+	if v == nil {
+		return "false"
+	}
+	return strconv.FormatBool(bool(*v))
+}
+
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+type scanModeValue ScanMode
+
+func (v *scanModeValue) Set(s string) error {
+	return (*ScanMode)(v).UnmarshalText([]byte(s))
+}
+
+func (v *scanModeValue) String() string {
+	if v == nil || *v == 0 {
+		return ""
+	}
+	return ScanMode(*v).String()
+}
+
+type bufferingValue Buffering
+
+func (v *bufferingValue) Set(s string) error {
+	return (*Buffering)(v).UnmarshalText([]byte(s))
+}
+
+func (v *bufferingValue) String() string {
+	if v == nil {
+		return DoubleBuffering.String()
+	}
+	return Buffering(*v).String()
+}
+
+type panelTypeValue PanelType
+
+func (v *panelTypeValue) Set(s string) error {
+	if err := PanelType(s).validate(); err != nil {
+		return err
+	}
+	*v = panelTypeValue(s)
+	return nil
+}
+
+func (v *panelTypeValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return string(*v)
+}
+
+type rowAddressTypeValue RowAddressType
+
+func (v *rowAddressTypeValue) Set(s string) error {
+	return (*RowAddressType)(v).UnmarshalText([]byte(s))
+}
+
+func (v *rowAddressTypeValue) String() string {
+	if v == nil {
+		return DirectRowAddress.String()
+	}
+	return RowAddressType(*v).String()
+}
+
+// mappingValue sets a HardwareMapping by its registered name.
+type mappingValue struct {
+	hm   *HardwareMapping
+	name string
+}
+
+func (v *mappingValue) Set(s string) error {
+	hm, ok := hardwareMappings[s]
+	if !ok {
+		return fmt.Errorf("unknown hardware mapping %q", s)
+	}
+	*v.hm = hm
+	v.name = s
+	return nil
+}
+
+func (v *mappingValue) String() string {
+	if v.name != "" || v.hm == nil {
+		return v.name
+	}
+	for name, hm := range hardwareMappings {
+		if hm == *v.hm {
+			return name
+		}
+	}
+	return ""
+}
+
+// pixelMapperValue sets pixel mappers from a ParsePixelMappers specification.
+type pixelMapperValue struct {
+	pms  *[]PixelMapper
+	spec string
+}
+
+func (v *pixelMapperValue) Set(s string) error {
+	pms, err := ParsePixelMappers(s)
+	if err != nil {
+		return err
+	}
+	*v.pms = pms
+	v.spec = s
+	return nil
+}
+
+func (v *pixelMapperValue) String() string {
+	if v.spec != "" || v.pms == nil {
+		return v.spec
+	}
+	specs := make([]string, len(*v.pms))
+	for i, pm := range *v.pms {
+		specs[i] = fmt.Sprint(pm)
+	}
+	return strings.Join(specs, ";")
+}
+
+// multiplexerValue sets a Multiplexer by its registered name, the empty name
+// meaning none.
+type multiplexerValue struct {
+	mux  *Multiplexer
+	name string
+}
+
+func (v *multiplexerValue) Set(s string) error {
+	var mux Multiplexer
+	if s != "" {
+		var ok bool
+		if mux, ok = multiplexers[s]; !ok {
+			return fmt.Errorf("unknown multiplexer %q", s)
+		}
+	}
+	*v.mux = mux
+	v.name = s
+	return nil
+}
+
+func (v *multiplexerValue) String() string {
+	if v.name != "" || v.mux == nil || *v.mux == nil {
+		return v.name
+	}
+	for name, mux := range multiplexers {
+		if mux == *v.mux {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,198 @@
+package matrix_test
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/post-l/hw/board/fake"
+	"github.com/post-l/hw/matrix"
+)
+
+func writeConfig(t *testing.T, name, data string) string {
+	dir, err := ioutil.TempDir("", "matrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	want := matrix.DefaultHardwareConfig
+	want.Rows = 32
+	want.PWMBits = 11
+	want.ScanMode = matrix.Progressive
+	want.Mapping = matrix.AdafruitHatHardwareMapping
+	want.PixelMappers = []matrix.PixelMapper{matrix.RotateMapper{Angle: 90}}
+
+	files := map[string]string{
+		"config.json": `{
+	"rows": 32,
+	"pixel_mapper": "Rotate:90",
+	"pwm_bits": 11,
+	"scan_mode": "progressive",
+	"hardware_mapping": "adafruit-hat"
+}`,
+		"config.conf": `# panel
+rows = 32
+pwm_bits = 11 # max
+pixel_mapper = "Rotate:90"
+scan_mode = progressive
+hardware_mapping = "adafruit-hat"
+`,
+	}
+	for name, data := range files {
+		hc, err := matrix.LoadConfig(writeConfig(t, name, data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*hc, want) {
+			t.Errorf("invalid %s config: got %+v; want %+v", name, *hc, want)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	files := map[string]string{
+		"brightness.json": `{"brightness": 101}`,
+		"pwm.conf":        "pwm_bits = 12",
+		"rows.conf":       "rows = 33",
+		"scan.conf":       "scan_mode = zigzag",
+		"mapping.json":    `{"hardware_mapping": "nope"}`,
+		"mapper.json":     `{"pixel_mapper": "Rotate:45"}`,
+		"unknown.conf":    "columns = 32",
+		"syntax.conf":     "rows 32",
+		"section.conf":    "[panel]\nrows = 32",
+		"string.conf":     `hardware_mapping = "regular`,
+		"trailing.conf":   `hardware_mapping = "regular" x`,
+		"config.toml":     "rows = 32",
+		"config.yaml":     "rows: 32",
+		"syntax.json":     "{\n\"rows\": 32,\n}",
+		"array.json":      `["rows"]`,
+	}
+	for name, data := range files {
+		if _, err := matrix.LoadConfig(writeConfig(t, name, data)); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestLoadConfigErrorLines(t *testing.T) {
+	files := map[string]string{
+		"syntax.json": "{\n\"rows\": 32,\n\"cols\" 32\n}",
+		"value.json":  "{\n\"rows\": 32,\n\"cols\": \"x\"\n}",
+		"value.conf":  "rows = 32\n\ncols = x",
+		"syntax.conf": "rows = 32\n\ncols 32",
+	}
+	for name, data := range files {
+		path := writeConfig(t, name, data)
+		_, err := matrix.LoadConfig(path)
+		if err == nil || !strings.HasPrefix(err.Error(), "matrix: "+path+": line 3: ") {
+			t.Errorf("%s: invalid error: got %v; want an error on line 3", name, err)
+		}
+	}
+}
+
+func TestLoadConfigWrapsErrors(t *testing.T) {
+	_, err := matrix.LoadConfig(writeConfig(t, "rows.conf", "rows = x"))
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Errorf("invalid error: got %v; want a *strconv.NumError", err)
+	}
+
+	hc := matrix.DefaultHardwareConfig
+	hc.Brightness = 101
+	want := hc.Validate()
+	path := writeConfig(t, "brightness.json", `{"brightness": 101}`)
+	_, err = matrix.LoadConfig(path)
+	if got := errors.Unwrap(err); got == nil || got.Error() != want.Error() {
+		t.Errorf("invalid wrapped error: got %v; want %v", got, want)
+	}
+	if got, want := err.Error(), "matrix: "+path+": "+strings.TrimPrefix(want.Error(), "matrix: "); got != want {
+		t.Errorf("invalid error: got %q; want %q", got, want)
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	hc := matrix.DefaultHardwareConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	matrix.RegisterFlags(fs, &hc)
+	err := fs.Parse([]string{
+		"-led-rows", "16",
+		"-led-brightness=50",
+		"-led-scan-mode", "progressive",
+		"-led-gpio-mapping", "regular",
+		"-led-pixel-mapper", "Mirror:H;Rotate:180",
+		"-led-multiplexing", "Checkered",
+		"-led-row-addr-type", "abc-shift",
+		"-led-buffering", "triple",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := matrix.DefaultHardwareConfig
+	want.Rows = 16
+	want.Brightness = 50
+	want.ScanMode = matrix.Progressive
+	want.Mapping = matrix.RegularHardwareMapping
+	want.PixelMappers = []matrix.PixelMapper{matrix.MirrorMapper{Horizontal: true}, matrix.RotateMapper{Angle: 180}}
+	want.Multiplexer = matrix.CheckeredMultiplexer{}
+	want.RowAddressType = matrix.ABCShiftRowAddress
+	want.Buffering = matrix.TripleBuffering
+	if !reflect.DeepEqual(hc, want) {
+		t.Errorf("invalid config: got %+v; want %+v", hc, want)
+	}
+	if err := hc.Validate(); err != nil {
+		t.Error(err)
+	}
+	if got, want := fs.Lookup("led-gpio-mapping").Value.String(), "regular"; got != want {
+		t.Errorf("invalid mapping flag: got %q; want %q", got, want)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(hc *matrix.HardwareConfig)
+	}{
+		{"PWMBits", func(hc *matrix.HardwareConfig) { hc.PWMBits = 12 }},
+		{"ZeroBrightness", func(hc *matrix.HardwareConfig) { hc.Brightness = 0 }},
+		{"ZeroCols", func(hc *matrix.HardwareConfig) { hc.Cols = 0 }},
+		{"ZeroChainLength", func(hc *matrix.HardwareConfig) { hc.ChainLength = 0 }},
+		{"Parallel", func(hc *matrix.HardwareConfig) { hc.Parallel = 4 }},
+		{"ParallelMapping", func(hc *matrix.HardwareConfig) { hc.Parallel = 2 }},
+		{"PanelType", func(hc *matrix.HardwareConfig) { hc.PanelType = "FM6128" }},
+		{"RowSelectRows", func(hc *matrix.HardwareConfig) { hc.Rows, hc.RowAddressType = 16, matrix.DirectRowSelect }},
+		{"RowAddressType", func(hc *matrix.HardwareConfig) { hc.RowAddressType = 3 }},
+		{"MultiplexerRows", func(hc *matrix.HardwareConfig) { hc.Rows, hc.Multiplexer = 30, matrix.StripeMultiplexer{} }},
+		{"PixelMapper", func(hc *matrix.HardwareConfig) {
+			hc.PixelMappers = []matrix.PixelMapper{matrix.RotateMapper{Angle: 45}}
+		}},
+		{"AddressLines", func(hc *matrix.HardwareConfig) { hc.Rows = 128 }},
+		{"OddRows", func(hc *matrix.HardwareConfig) { hc.Rows = 31 }},
+		{"ScanMode", func(hc *matrix.HardwareConfig) { hc.ScanMode = 0 }},
+		{"Mapping", func(hc *matrix.HardwareConfig) { hc.Mapping.B2 = hc.Mapping.R1 }},
+		{"MappingPin", func(hc *matrix.HardwareConfig) { hc.Mapping.Clock = -1 }},
+	}
+	for _, test := range tests {
+		hc := matrix.DefaultHardwareConfig
+		test.fn(&hc)
+		m, err := matrix.New(fake.New(), &hc)
+		if err == nil {
+			m.Close()
+			t.Errorf("%s: got no error", test.name)
+		}
+	}
+}
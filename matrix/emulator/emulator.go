@@ -24,20 +24,32 @@ type Emulator struct {
 	PixelPitchToGutterRatio int
 	Margin                  int
 
-	leds []color.RGBA
-	w    screen.Window
-	s    screen.Screen
-	sz   size.Event
+	layout *matrix.Layout
+	leds   []color.RGBA
+	w      screen.Window
+	s      screen.Screen
+	sz     size.Event
 }
 
+// NewEmulator returns an emulator of the panels of hc, showing them as
+// chained. It panics if the pixel mappers of hc are invalid.
 func NewEmulator(hc *matrix.HardwareConfig) *Emulator {
+	// The emulated panels show the pixels as laid out, without multiplexing.
+	ehc := *hc
+	ehc.Multiplexer = nil
+	layout, err := matrix.NewLayout(&ehc)
+	if err != nil {
+		panic(err)
+	}
+	width, height := hc.Cols*hc.ChainLength, hc.Rows*hc.Parallel
 	e := &Emulator{
-		Width:                   hc.Cols,
-		Height:                  hc.Rows,
+		Width:                   width,
+		Height:                  height,
 		GutterColor:             color.Gray{Y: 20},
 		PixelPitchToGutterRatio: 2,
 		Margin:                  10,
-		leds:                    make([]color.RGBA, hc.Cols*hc.Rows),
+		layout:                  layout,
+		leds:                    make([]color.RGBA, width*height),
 	}
 	pixelPitch := 6
 	e.updatePixelPitchForGutter(pixelPitch / e.PixelPitchToGutterRatio)
@@ -95,22 +107,30 @@ func (e *Emulator) Close() {
 // ColorModel returns the canvas' color model, always color.RGBAModel
 func (e *Emulator) ColorModel() color.Model { return color.RGBAModel }
 
-// Bounds return the topology of the Canvas
-func (e *Emulator) Bounds() image.Rectangle { return image.Rect(0, 0, e.Width, e.Height) }
+// Bounds return the topology of the Canvas, as arranged by the pixel mappers
+func (e *Emulator) Bounds() image.Rectangle { return e.layout.Bounds() }
 
 func (e *Emulator) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(e.Bounds())) {
+		return color.RGBA{}
+	}
+	x, y = e.layout.Map(x, y)
 	pos := x + (y * e.Width)
 	return e.leds[pos]
 }
 
 func (e *Emulator) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(e.Bounds())) {
+		return
+	}
+	x, y = e.layout.Map(x, y)
 	pos := x + (y * e.Width)
 	e.leds[pos] = color.RGBAModel.Convert(c).(color.RGBA)
 }
 
-func (e *Emulator) Render() {
+func (e *Emulator) Render() error {
 	if e.w == nil {
-		return
+		return nil
 	}
 	gutterWidth := e.calculateGutterForViewableArea()
 	e.updatePixelPitchForGutter(gutterWidth)
@@ -118,11 +138,12 @@ func (e *Emulator) Render() {
 	for row := 0; row < e.Height; row++ {
 		for col := 0; col < e.Width; col++ {
 			dr := e.ledRect(col, row)
-			c := e.At(col, row)
+			c := e.leds[col+row*e.Width]
 			e.w.Fill(dr, c, screen.Src)
 		}
 	}
 	e.w.Publish()
+	return nil
 }
 
 // Some formulas that allowed me to better understand the drawable area. I found that the math was
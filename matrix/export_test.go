@@ -0,0 +1,7 @@
+package matrix
+
+// UnregisterHardwareMapping removes the mapping registered as name, so the
+// tests registering a mapping leave the registry as they found it.
+func UnregisterHardwareMapping(name string) {
+	delete(hardwareMappings, name)
+}
@@ -0,0 +1,189 @@
+package matrix
+
+import (
+	"image"
+	"image/color"
+	"sync/atomic"
+	"time"
+)
+
+// Frame is an off screen canvas of a Matrix, like the frame canvases of
+// rpi-rgb-led-matrix. A frame got from NextFrame belongs to its caller until
+// given back to Swap, the matrix never touching it meanwhile, so several
+// goroutines can draw their own frames. A frame is not safe for concurrent
+// use.
+type Frame struct {
+	m *Matrix
+	// buf holds, per double row, bit plane and column, the color bits of
+	// the parallel chains, r1, g1, b1, r2, g2 and b2 of the first chain in
+	// the lowest bits.
+	buf []uint32
+	// img is the logical image last set, read back by At.
+	img *image.RGBA
+	// queued is the time the frame was swapped, guarded by Matrix.mu.
+	queued time.Time
+}
+
+func (m *Matrix) newFrame() *Frame {
+	return &Frame{
+		m:   m,
+		buf: make([]uint32, m.hc.PWMBits*m.width*m.dRows),
+		img: image.NewRGBA(m.layout.Bounds()),
+	}
+}
+
+// NextFrame returns a frame to draw the next image on. It holds the image
+// of a previously displayed frame, if any, or is blank.
+func (m *Matrix) NextFrame() *Frame {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n := len(m.free); n > 0 {
+		f := m.free[n-1]
+		m.free = m.free[:n-1]
+		return f
+	}
+	return m.newFrame()
+}
+
+// Swap displays f once the frame currently displayed has been fully scanned,
+// so that the panel never shows parts of both. With DoubleBuffering, it
+// waits for f to be displayed. With TripleBuffering, it queues f and returns,
+// dropping the frame queued before if not displayed yet. The previously
+// displayed and dropped frames are then returned by NextFrame. f must not be
+// used after Swap, unless it returns ErrClosed, the matrix being closed.
+func (m *Matrix) Swap(f *Frame) error {
+	m.checkFrame(f)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if m.hc.Buffering == TripleBuffering {
+		m.queue(f)
+		return nil
+	}
+	for m.pending != nil && !m.closed {
+		m.swapped.Wait()
+	}
+	if m.closed {
+		return ErrClosed
+	}
+	m.pending, f.queued = f, time.Now()
+	for m.pending == f && !m.closed {
+		m.swapped.Wait()
+	}
+	if m.pending == f {
+		m.pending = nil
+		return ErrClosed
+	}
+	return nil
+}
+
+// TrySwap is Swap without waiting. With DoubleBuffering, it queues f only if
+// no other frame is waiting to be displayed. It reports whether f was
+// queued, f being still owned by the caller otherwise, as when the matrix is
+// closed.
+func (m *Matrix) TrySwap(f *Frame) bool {
+	m.checkFrame(f)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || m.pending != nil && m.hc.Buffering != TripleBuffering {
+		return false
+	}
+	m.queue(f)
+	return true
+}
+
+func (m *Matrix) checkFrame(f *Frame) {
+	if f.m != m {
+		panic("matrix: swapping a frame of another matrix")
+	}
+}
+
+// queue makes f the next frame displayed, dropping the one queued, if any.
+// m.mu must be held.
+func (m *Matrix) queue(f *Frame) {
+	if m.pending != nil {
+		m.free = append(m.free, m.pending)
+		atomic.AddUint64(&m.stats.droppedSwaps, 1)
+	}
+	m.pending, f.queued = f, time.Now()
+}
+
+// release makes f returned by NextFrame.
+func (m *Matrix) release(f *Frame) {
+	m.mu.Lock()
+	m.free = append(m.free, f)
+	m.mu.Unlock()
+}
+
+// vsync returns the frame to display after cur, the pending one if any,
+// freeing cur.
+func (m *Matrix) vsync(cur *Frame) *Frame {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending == nil {
+		return cur
+	}
+	m.free = append(m.free, cur)
+	cur, m.pending = m.pending, nil
+	atomic.AddUint64(&m.stats.swaps, 1)
+	atomic.StoreInt64(&m.stats.swapLatency, int64(time.Since(cur.queued)))
+	m.swapped.Broadcast()
+	return cur
+}
+
+// copyFrom copies the image of src to f.
+func (f *Frame) copyFrom(src *Frame) {
+	copy(f.buf, src.buf)
+	copy(f.img.Pix, src.img.Pix)
+}
+
+// ColorModel returns the frame's color model, always color.RGBAModel
+func (f *Frame) ColorModel() color.Model { return color.RGBAModel }
+
+// Bounds returns the bounds of the matrix
+func (f *Frame) Bounds() image.Rectangle { return f.img.Rect }
+
+// At returns the color last set at x, y, before the luminance correction.
+func (f *Frame) At(x, y int) color.Color { return f.img.RGBAAt(x, y) }
+
+func (f *Frame) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(f.img.Rect)) {
+		return
+	}
+	m := f.m
+	co := color.RGBAModel.Convert(c).(color.RGBA)
+	f.img.SetRGBA(x, y, co)
+	x, y = m.layout.Map(x, y)
+	chain := y / (2 * m.dRows)
+	y -= chain * 2 * m.dRows
+	shift := uint(6 * chain)
+	if y >= m.dRows {
+		shift += 3
+		y -= m.dRows
+	}
+	colorMask := ^(uint32(7) << shift)
+	roffset, goffset, boffset := uint32(1)<<shift, uint32(2)<<shift, uint32(4)<<shift
+	i := x + y*m.width*m.hc.PWMBits
+	m.pwmMu.RLock()
+	r := m.cie[co.R]
+	g := m.cie[co.G]
+	b := m.cie[co.B]
+	m.pwmMu.RUnlock()
+	for bit := uint(0); bit < uint(m.hc.PWMBits); bit++ {
+		colorBits := f.buf[i] & colorMask
+		mask := uint16(1 << bit)
+		if r&mask != 0 {
+			colorBits |= roffset
+		}
+		if g&mask != 0 {
+			colorBits |= goffset
+		}
+		if b&mask != 0 {
+			colorBits |= boffset
+		}
+		f.buf[i] = colorBits
+		i += m.width
+	}
+}
@@ -0,0 +1,233 @@
+package matrix
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/post-l/hw/board/fake"
+)
+
+// solidColor returns a color whose components are all off or all on, so that
+// every bit plane of a solid frame holds the same data.
+func solidColor(i int) color.RGBA {
+	c := color.RGBA{A: 255}
+	if i&1 != 0 {
+		c.R = 255
+	}
+	if i&2 != 0 {
+		c.G = 255
+	}
+	if i&4 != 0 {
+		c.B = 255
+	}
+	return c
+}
+
+func TestFrames(t *testing.T) {
+	b := fake.New()
+	hc := testConfig(8, 4, 2, Progressive)
+	m, err := New(b, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 3; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				f := m.NextFrame()
+				c := image.NewUniform(solidColor(1 + (g*10+i)%7))
+				draw.Draw(f, f.Bounds(), c, image.ZP, draw.Src)
+				m.Swap(f)
+			}
+		}(g)
+	}
+	// The draw.Image API is safe for concurrent use too.
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				c := image.NewUniform(solidColor(1 + g))
+				draw.Draw(m, m.Bounds(), c, image.ZP, draw.Src)
+				m.Render()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Every scanned frame holds a single color, no swap happening in the
+	// middle of a frame.
+	hm := hc.Mapping
+	tr := b.Trace()
+	clocks := tr.Clocks(hm.Clock, []int{hm.R1, hm.G1, hm.B1, hm.R2, hm.G2, hm.B2})
+	latches := tr.Latches(hm.Strobe, []int{hm.A, hm.B, hm.C, hm.D, hm.E})
+	frame, ci := -1, 0
+	var frameBits uint32
+	colors := make(map[uint32]bool)
+	for li, l := range latches {
+		if l.Bits == 0 && (li == 0 || latches[li-1].Bits != 0) {
+			frame++
+			frameBits = 0
+		}
+		for ; ci < len(clocks) && clocks[ci].Seq < l.Seq; ci++ {
+			if frame < 0 {
+				continue
+			}
+			bits := clocks[ci].Bits
+			if frameBits == 0 {
+				frameBits = bits
+			}
+			if bits != frameBits {
+				t.Fatalf("torn frame %d: got data %#x; want %#x", frame, bits, frameBits)
+			}
+			colors[bits] = true
+		}
+	}
+	if len(colors) < 2 {
+		t.Errorf("invalid scanned colors: got %d; want several", len(colors))
+	}
+}
+
+func TestNextFrame(t *testing.T) {
+	hc := testConfig(8, 4, 2, Progressive)
+	m, err := New(fake.New(), hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	f1 := m.NextFrame()
+	f1.Set(1, 2, color.RGBA{R: 255, A: 255})
+	m.Swap(f1)
+	f2 := m.NextFrame()
+	m.Swap(f2)
+	// f1 was displayed, then freed by the swap of f2.
+	if got := m.NextFrame(); got != f1 {
+		t.Errorf("invalid next frame: got %p; want %p", got, f1)
+	}
+	if got, want := f1.At(1, 2), (color.RGBA{R: 255, A: 255}); got != want {
+		t.Errorf("invalid pixel: got %v; want %v", got, want)
+	}
+}
+
+func TestBuffering(t *testing.T) {
+	for _, buffering := range []Buffering{DoubleBuffering, TripleBuffering} {
+		t.Run(buffering.String(), func(t *testing.T) {
+			b := fake.New()
+			hc := testConfig(8, 4, 2, Progressive)
+			hc.Buffering = buffering
+			m, err := New(b, hc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			// Each render draws one more pixel over the previous ones.
+			queued := 0
+			for i := 0; i < 32; i++ {
+				m.Set(i%4, i/4, solidColor(1+i%7))
+				if m.TryRender() {
+					queued++
+				}
+				m.Render()
+			}
+			if buffering == TripleBuffering && queued != 32 {
+				t.Errorf("invalid queued renders: got %d; want 32", queued)
+			}
+			want := image.NewRGBA(m.Bounds())
+			for i := 0; i < 32; i++ {
+				want.SetRGBA(i%4, i/4, solidColor(1+i%7))
+			}
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 4; x++ {
+					if got, want := m.At(x, y), want.RGBAAt(x, y); got != want {
+						t.Errorf("invalid pixel (%d, %d): got %v; want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := fake.New()
+	hc := testConfig(8, 4, 2, Progressive)
+	hc.CloseBoard = true
+	m, err := New(b, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draw.Draw(m, m.Bounds(), image.NewUniform(solidColor(7)), image.ZP, draw.Src)
+	if err := m.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The scan is over.
+	n := len(b.Trace())
+	time.Sleep(10 * time.Millisecond)
+	if got := len(b.Trace()); got != n {
+		t.Errorf("invalid trace after Close: got %d calls; want %d", got, n)
+	}
+	hm := hc.Mapping
+	if !b.DigitalRead(hm.OutputEnable) {
+		t.Error("expect the output enable to be high")
+	}
+	for _, pin := range append(hm.colorPins(1), hm.Clock, hm.Strobe) {
+		if b.DigitalRead(pin) {
+			t.Errorf("expect pin %d to be low", pin)
+		}
+	}
+	if !b.Closed() {
+		t.Error("expect the board to be closed")
+	}
+
+	if err := m.Render(); !errors.Is(err, ErrClosed) {
+		t.Errorf("invalid Render error: got %v; want %v", err, ErrClosed)
+	}
+	if err := m.Swap(m.NextFrame()); !errors.Is(err, ErrClosed) {
+		t.Errorf("invalid Swap error: got %v; want %v", err, ErrClosed)
+	}
+	if m.TryRender() {
+		t.Error("expect TryRender to queue nothing")
+	}
+	if err := m.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("invalid Close error: got %v; want %v", err, ErrClosed)
+	}
+}
+
+func TestCloseWhileSwapping(t *testing.T) {
+	m, err := New(fake.New(), testConfig(8, 4, 2, Progressive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error)
+	for g := 0; g < 4; g++ {
+		go func() {
+			for {
+				if err := m.Render(); err != nil {
+					errc <- err
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	m.Close()
+	for g := 0; g < 4; g++ {
+		if err := <-errc; !errors.Is(err, ErrClosed) {
+			t.Errorf("invalid Render error: got %v; want %v", err, ErrClosed)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package matrix
 
+import (
+	"errors"
+	"fmt"
+)
+
 type ScanMode int
 
 const (
@@ -7,15 +12,92 @@ const (
 	Interlaced
 )
 
+var scanModeNames = map[ScanMode]string{
+	Progressive: "progressive",
+	Interlaced:  "interlaced",
+}
+
+func (sm ScanMode) String() string {
+	if name, ok := scanModeNames[sm]; ok {
+		return name
+	}
+	return fmt.Sprintf("ScanMode(%d)", int(sm))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (sm ScanMode) MarshalText() ([]byte, error) {
+	if _, ok := scanModeNames[sm]; !ok {
+		return nil, fmt.Errorf("matrix: invalid scan mode %d", int(sm))
+	}
+	return []byte(sm.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting "progressive"
+// and "interlaced".
+func (sm *ScanMode) UnmarshalText(text []byte) error {
+	for mode, name := range scanModeNames {
+		if string(text) == name {
+			*sm = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("matrix: invalid scan mode %q", text)
+}
+
+// Buffering is the way frames are handed to the refresh of the panels, see
+// Matrix.Swap.
+type Buffering int
+
+const (
+	// DoubleBuffering displays a frame at the next vsync, waiting for it.
+	DoubleBuffering Buffering = iota
+	// TripleBuffering queues a frame without waiting, dropping the frame
+	// queued before if it was not displayed yet.
+	TripleBuffering
+)
+
+var bufferingNames = map[Buffering]string{
+	DoubleBuffering: "double",
+	TripleBuffering: "triple",
+}
+
+func (bf Buffering) String() string {
+	if name, ok := bufferingNames[bf]; ok {
+		return name
+	}
+	return fmt.Sprintf("Buffering(%d)", int(bf))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (bf Buffering) MarshalText() ([]byte, error) {
+	if _, ok := bufferingNames[bf]; !ok {
+		return nil, fmt.Errorf("matrix: invalid buffering %d", int(bf))
+	}
+	return []byte(bf.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting "double" and
+// "triple".
+func (bf *Buffering) UnmarshalText(text []byte) error {
+	for b, name := range bufferingNames {
+		if string(text) == name {
+			*bf = b
+			return nil
+		}
+	}
+	return fmt.Errorf("matrix: invalid buffering %q", text)
+}
+
 // DefaultHardwareConfig default WS281x configuration
 var DefaultHardwareConfig = HardwareConfig{
-	Rows:            64,
-	Cols:            64,
-	PWMBits:         5,
-	Brightness:      100,
-	ScanMode:        Interlaced,
-	Mapping:         DefaultHardwareMapping,
-	ShowRefreshRate: true,
+	Rows:        64,
+	Cols:        64,
+	ChainLength: 1,
+	Parallel:    1,
+	PWMBits:     5,
+	Brightness:  100,
+	ScanMode:    Interlaced,
+	Mapping:     DefaultHardwareMapping,
 }
 
 // HardwareConfig rgb-led-matrix configuration
@@ -24,6 +106,23 @@ type HardwareConfig struct {
 	Rows int
 	// Cols the number of columns supported by the display, so 32 or 64 .
 	Cols int
+	// ChainLength is the number of daisy-chained panels, the matrix being
+	// ChainLength*Cols pixels wide.
+	ChainLength int
+	// Parallel is the number of chains, 1 to 3, driven at once through the
+	// parallel color pins of the mapping. The chains are stacked vertically,
+	// the matrix being Parallel*Rows pixels high.
+	Parallel int
+	// Multiplexer maps the pixels of outdoor panels scanning fewer rows at
+	// once, nil for the panels scanning Rows/2 double rows.
+	Multiplexer Multiplexer
+	// PanelType is the driver chip of the panels, initialized by New.
+	PanelType PanelType
+	// RowAddressType is the way the panels select the displayed row.
+	RowAddressType RowAddressType
+	// PixelMappers maps the logical pixels to the panels, the first mapper
+	// being applied over the panels. See ParsePixelMappers.
+	PixelMappers []PixelMapper
 	// PWMBits sets PWM bits used for output. Default is 11, but if you only deal with
 	// limited comic-colors, 1 might be sufficient. Lower require less CPU and
 	// increases refresh-rate.
@@ -32,7 +131,76 @@ type HardwareConfig struct {
 	// is 1..100
 	Brightness int
 	// ScanMode progressive or interlaced
-	ScanMode        ScanMode // strip color layout
-	Mapping         HardwareMapping
-	ShowRefreshRate bool
+	ScanMode ScanMode // strip color layout
+	Mapping  HardwareMapping
+	// StatsFunc, if not nil, is called with the Matrix stats every second,
+	// from the goroutine refreshing the panels, so it must return quickly.
+	StatsFunc func(Stats)
+	// Buffering is the way Render and Swap hand frames to the refresh.
+	Buffering Buffering
+	// CloseBoard makes Matrix.Close close the board too.
+	CloseBoard bool
+}
+
+// addrLinesLen is the number of row address lines, A to E.
+const addrLinesLen = 5
+
+// Validate returns an error describing the first invalid value of hc. The
+// mapping is checked for duplicate pins only, matrix.New checking its pins
+// against the board.
+func (hc *HardwareConfig) Validate() error {
+	stretch := 1
+	if hc.Multiplexer != nil {
+		stretch = hc.Multiplexer.StretchFactor()
+		if stretch < 1 {
+			return fmt.Errorf("matrix: invalid multiplexer stretch factor %d", stretch)
+		}
+	}
+	_, rows := hc.panelSize()
+	switch {
+	case hc.Rows <= 0 || hc.Rows%(2*stretch) != 0:
+		return fmt.Errorf("matrix: invalid rows %d, must be a positive multiple of %d, the panel scanning two rows at once", hc.Rows, 2*stretch)
+	case hc.RowAddressType.maxDRows() == 0:
+		return fmt.Errorf("matrix: invalid row address type %d", int(hc.RowAddressType))
+	case hc.RowAddressType.maxDRows() > 0 && rows/2 > hc.RowAddressType.maxDRows():
+		return fmt.Errorf("matrix: invalid rows %d, %s addressing can't select more than %d double rows", hc.Rows, hc.RowAddressType, hc.RowAddressType.maxDRows())
+	case hc.Cols <= 0:
+		return fmt.Errorf("matrix: invalid cols %d, must be positive", hc.Cols)
+	case hc.ChainLength < 1:
+		return fmt.Errorf("matrix: invalid chain length %d, must be positive", hc.ChainLength)
+	case hc.Parallel < 1 || hc.Parallel > maxParallel:
+		return fmt.Errorf("matrix: invalid parallel %d, must be in 1..%d", hc.Parallel, maxParallel)
+	case hc.PWMBits < 1 || hc.PWMBits > pwmBitsLen:
+		return fmt.Errorf("matrix: invalid pwm bits %d, must be in 1..%d", hc.PWMBits, pwmBitsLen)
+	case hc.Brightness < 1 || hc.Brightness > 100:
+		return fmt.Errorf("matrix: invalid brightness %d, must be in 1..100", hc.Brightness)
+	}
+	if mv, ok := hc.Multiplexer.(MultiplexerValidator); ok {
+		if err := mv.Validate(hc.Cols, hc.Rows); err != nil {
+			return err
+		}
+	}
+	if err := hc.PanelType.validate(); err != nil {
+		return err
+	}
+	if _, ok := scanModeNames[hc.ScanMode]; !ok {
+		return errors.New("matrix: invalid scan mode, must be progressive or interlaced")
+	}
+	if _, ok := bufferingNames[hc.Buffering]; !ok {
+		return errors.New("matrix: invalid buffering, must be double or triple")
+	}
+	if _, err := NewLayout(hc); err != nil {
+		return err
+	}
+	return hc.Mapping.validate(nil, hc.Parallel)
+}
+
+// panelSize returns the size of a panel as driven, stretched by the
+// multiplexer.
+func (hc *HardwareConfig) panelSize() (cols, rows int) {
+	if hc.Multiplexer == nil {
+		return hc.Cols, hc.Rows
+	}
+	s := hc.Multiplexer.StretchFactor()
+	return hc.Cols * s, hc.Rows / s
 }
@@ -1,42 +1,236 @@
 package matrix
 
-import "github.com/post-l/hw/board/tinkerboard"
+import (
+	"fmt"
+	"sort"
 
+	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/tinkerboard"
+)
+
+// DefaultHardwareMapping is the Adafruit RGB Matrix HAT wiring translated for
+// the Tinker Board.
 var DefaultHardwareMapping = HardwareMapping{
-	outputEnable: tinkerboard.GPIO0_C1,
-	clock:        tinkerboard.GPIO5_B4,
-	strobe:       tinkerboard.GPIO6_A4,
+	OutputEnable: tinkerboard.GPIO0_C1,
+	Clock:        tinkerboard.GPIO5_B4,
+	Strobe:       tinkerboard.GPIO6_A4,
+
+	A: tinkerboard.GPIO5_B7,
+	B: tinkerboard.GPIO7_B0,
+	C: tinkerboard.GPIO5_B6,
+	D: tinkerboard.GPIO6_A3,
+	E: tinkerboard.GPIO5_B3,
+
+	R1: tinkerboard.GPIO5_B5,
+	G1: tinkerboard.GPIO5_C0,
+	B1: tinkerboard.GPIO7_C6,
+
+	R2: tinkerboard.GPIO7_C7,
+	G2: tinkerboard.GPIO5_B2,
+	B2: tinkerboard.GPIO7_A7,
+}
+
+// RegularHardwareMapping is the rpi-rgb-led-matrix direct wiring on a
+// Raspberry Pi, using BCM GPIO numbers.
+var RegularHardwareMapping = HardwareMapping{
+	OutputEnable: 18,
+	Clock:        17,
+	Strobe:       4,
+
+	A: 22,
+	B: 23,
+	C: 24,
+	D: 25,
+	E: 15,
+
+	R1: 11,
+	G1: 27,
+	B1: 7,
+
+	R2: 8,
+	G2: 9,
+	B2: 10,
+
+	ParallelColors: [maxParallel - 1]ColorPins{
+		{R1: 12, G1: 5, B1: 6, R2: 19, G2: 13, B2: 20},
+		{R1: 14, G1: 2, B1: 3, R2: 26, G2: 16, B2: 21},
+	},
+}
+
+// AdafruitHatHardwareMapping is the Adafruit RGB Matrix HAT wiring on a
+// Raspberry Pi, using BCM GPIO numbers.
+var AdafruitHatHardwareMapping = HardwareMapping{
+	OutputEnable: 4,
+	Clock:        17,
+	Strobe:       21,
 
-	a: tinkerboard.GPIO5_B7,
-	b: tinkerboard.GPIO7_B0,
-	c: tinkerboard.GPIO5_B6,
-	d: tinkerboard.GPIO6_A3,
-	e: tinkerboard.GPIO5_B3,
+	A: 22,
+	B: 26,
+	C: 27,
+	D: 20,
+	E: 24,
 
-	r1: tinkerboard.GPIO5_B5,
-	g1: tinkerboard.GPIO5_C0,
-	b1: tinkerboard.GPIO7_C6,
+	R1: 5,
+	G1: 13,
+	B1: 6,
 
-	r2: tinkerboard.GPIO7_C7,
-	g2: tinkerboard.GPIO5_B2,
-	b2: tinkerboard.GPIO7_A7,
+	R2: 12,
+	G2: 16,
+	B2: 23,
 }
 
+// AdafruitHatPWMHardwareMapping is AdafruitHatHardwareMapping with the
+// output enable moved to GPIO18, the hardware PWM pin, as done by soldering
+// GPIO4 and GPIO18 together on the HAT.
+var AdafruitHatPWMHardwareMapping = func() HardwareMapping {
+	hm := AdafruitHatHardwareMapping
+	hm.OutputEnable = 18
+	return hm
+}()
+
+var hardwareMappings = map[string]HardwareMapping{
+	"regular":             RegularHardwareMapping,
+	"adafruit-hat":        AdafruitHatHardwareMapping,
+	"adafruit-hat-pwm":    AdafruitHatPWMHardwareMapping,
+	"tinkerboard-default": DefaultHardwareMapping,
+}
+
+// maxParallel is the maximum number of parallel chains.
+const maxParallel = 3
+
+// HardwareMapping is the wiring of the panel HUB75 connector to the board
+// pins.
 type HardwareMapping struct {
-	outputEnable int
-	clock        int
-	strobe       int
+	OutputEnable int
+	Clock        int
+	Strobe       int
+
+	A, B, C, D, E int
+	R1, G1, B1    int
+	R2, G2, B2    int
+
+	// ParallelColors holds the color pins of the second and third parallel
+	// chains, sharing the other pins with the first one. A zero ColorPins
+	// means the mapping does not support the chain.
+	ParallelColors [maxParallel - 1]ColorPins
+}
+
+// ColorPins are the color pins of a parallel chain.
+type ColorPins struct {
+	R1, G1, B1 int
+	R2, G2, B2 int
+}
 
-	a, b, c, d, e int
-	r1, g1, b1    int
-	r2, g2, b2    int
+// NewHardwareMapping returns the mapping registered as name, validated for b.
+func NewHardwareMapping(name string, b board.Board) (HardwareMapping, error) {
+	hm, ok := hardwareMappings[name]
+	if !ok {
+		return HardwareMapping{}, fmt.Errorf("matrix: unknown hardware mapping %q", name)
+	}
+	if err := hm.Validate(b); err != nil {
+		return HardwareMapping{}, err
+	}
+	return hm, nil
+}
+
+// RegisterHardwareMapping registers hm as name, replacing any mapping already
+// registered as name. It returns an error if hm uses a pin twice.
+func RegisterHardwareMapping(name string, hm HardwareMapping) error {
+	if err := hm.Validate(nil); err != nil {
+		return err
+	}
+	hardwareMappings[name] = hm
+	return nil
+}
+
+// HardwareMappingNames returns the registered mapping names, sorted.
+func HardwareMappingNames() []string {
+	names := make([]string, 0, len(hardwareMappings))
+	for name := range hardwareMappings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate returns an error if a pin is used twice, or if b is not nil and
+// cannot use one of the pins, see board.CheckPin. The pins of all the
+// parallel chains the mapping supports are checked.
+func (hm *HardwareMapping) Validate(b board.Board) error {
+	return hm.validate(b, hm.parallel())
+}
+
+// validate is Validate for the first parallel chains only.
+func (hm *HardwareMapping) validate(b board.Board, parallel int) error {
+	if parallel > hm.parallel() {
+		return fmt.Errorf("matrix: hardware mapping supports %d parallel chains, not %d", hm.parallel(), parallel)
+	}
+	used := make(map[int]string)
+	for _, f := range hm.fields(parallel) {
+		if name, ok := used[f.pin]; ok {
+			return fmt.Errorf("matrix: hardware mapping uses pin %d for both %s and %s", f.pin, name, f.name)
+		}
+		used[f.pin] = f.name
+		if b == nil {
+			continue
+		}
+		if err := board.CheckPin(b, f.pin); err != nil {
+			return fmt.Errorf("matrix: hardware mapping %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+type mappingField struct {
+	name string
+	pin  int
+}
+
+// fields returns the pins used by the first parallel chains.
+func (hm *HardwareMapping) fields(parallel int) []mappingField {
+	fs := []mappingField{
+		{"OutputEnable", hm.OutputEnable}, {"Clock", hm.Clock}, {"Strobe", hm.Strobe},
+		{"A", hm.A}, {"B", hm.B}, {"C", hm.C}, {"D", hm.D}, {"E", hm.E},
+		{"R1", hm.R1}, {"G1", hm.G1}, {"B1", hm.B1},
+		{"R2", hm.R2}, {"G2", hm.G2}, {"B2", hm.B2},
+	}
+	for i, cp := range hm.ParallelColors[:parallel-1] {
+		name := fmt.Sprintf("ParallelColors[%d].", i)
+		fs = append(fs,
+			mappingField{name + "R1", cp.R1}, mappingField{name + "G1", cp.G1}, mappingField{name + "B1", cp.B1},
+			mappingField{name + "R2", cp.R2}, mappingField{name + "G2", cp.G2}, mappingField{name + "B2", cp.B2},
+		)
+	}
+	return fs
+}
+
+// parallel returns the number of parallel chains supported by hm.
+func (hm *HardwareMapping) parallel() int {
+	n := 1
+	for _, cp := range hm.ParallelColors {
+		if cp == (ColorPins{}) {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// colorPins returns the color pins of the first parallel chains, r1, g1, b1,
+// r2, g2 and b2 for each chain.
+func (hm *HardwareMapping) colorPins(parallel int) []int {
+	pins := []int{hm.R1, hm.G1, hm.B1, hm.R2, hm.G2, hm.B2}
+	for _, cp := range hm.ParallelColors[:parallel-1] {
+		pins = append(pins, cp.R1, cp.G1, cp.B1, cp.R2, cp.G2, cp.B2)
+	}
+	return pins
 }
 
-func (hm *HardwareMapping) pins() []int {
-	return []int{
-		hm.outputEnable, hm.clock, hm.strobe,
-		hm.a, hm.b, hm.c, hm.d, hm.e,
-		hm.r1, hm.g1, hm.b1,
-		hm.r2, hm.g2, hm.b2,
+func (hm *HardwareMapping) pins(parallel int) []int {
+	fs := hm.fields(parallel)
+	pins := make([]int, len(fs))
+	for i, f := range fs {
+		pins[i] = f.pin
 	}
+	return pins
 }
@@ -0,0 +1,66 @@
+package matrix_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/post-l/hw/board"
+	"github.com/post-l/hw/board/fake"
+	"github.com/post-l/hw/board/rpi"
+	"github.com/post-l/hw/board/tinkerboard"
+	"github.com/post-l/hw/matrix"
+)
+
+type memory struct{}
+
+func (memory) Map(offset int64, length int) ([]uint32, error) { return make([]uint32, length/4), nil }
+func (memory) Close() error                                   { return nil }
+
+func TestHardwareMapping(t *testing.T) {
+	tb, err := tinkerboard.NewWithMemory(memory{})
+	if err != nil {
+		t.Fatal("board:", err)
+	}
+	rp, err := rpi.NewWithMemory(memory{}, 0)
+	if err != nil {
+		t.Fatal("board:", err)
+	}
+	tt := []struct {
+		name    string
+		b       board.Board
+		wantErr error
+	}{
+		{"tinkerboard-default", tb, nil},
+		{"regular", rp, nil},
+		{"adafruit-hat", rp, nil},
+		{"adafruit-hat-pwm", rp, nil},
+		{"adafruit-hat", tb, board.ErrInvalidPin},
+		{"adafruit-hat", fake.New(), nil},
+	}
+	for _, tc := range tt {
+		hm, err := matrix.NewHardwareMapping(tc.name, tc.b)
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("%s: invalid NewHardwareMapping error: got %v; want %v", tc.name, err, tc.wantErr)
+		}
+		if err == nil && hm.Clock == hm.Strobe {
+			t.Errorf("%s: invalid mapping %+v", tc.name, hm)
+		}
+	}
+	if _, err := matrix.NewHardwareMapping("unknown", tb); err == nil {
+		t.Error("expect NewHardwareMapping to return an error for an unknown mapping")
+	}
+
+	hm := matrix.DefaultHardwareMapping
+	hm.B2 = hm.R1
+	if err := matrix.RegisterHardwareMapping("invalid", hm); err == nil {
+		t.Error("expect RegisterHardwareMapping to return an error for a pin used twice")
+	}
+	hm.B2 = tinkerboard.GPIO6_A2
+	if err := matrix.RegisterHardwareMapping("custom", hm); err != nil {
+		t.Fatalf("expect RegisterHardwareMapping to return no error: %v", err)
+	}
+	t.Cleanup(func() { matrix.UnregisterHardwareMapping("custom") })
+	if _, err := matrix.NewHardwareMapping("custom", tb); !errors.Is(err, board.ErrInvalidPin) {
+		t.Errorf("invalid NewHardwareMapping error: got %v; want %v", err, board.ErrInvalidPin)
+	}
+}
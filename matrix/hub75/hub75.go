@@ -0,0 +1,154 @@
+// Package hub75 decodes the HUB75 signals recorded by a fake board back into
+// the image a LED panel would show, to test the matrix driver without one.
+package hub75
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/post-l/hw/board/fake"
+)
+
+// Pins describes the HUB75 wiring of the decoded panels.
+type Pins struct {
+	Clock        int
+	Strobe       int
+	OutputEnable int
+	// Address holds the row address pins, A first.
+	Address []int
+	// Colors holds, per parallel chain, the r1, g1, b1, r2, g2 and b2 pins.
+	Colors [][6]int
+}
+
+// Config describes the decoded panels.
+type Config struct {
+	Pins Pins
+	// Width is the number of pixels shifted per row.
+	Width int
+	// Height is the number of rows of a chain, twice the number of addressed
+	// rows.
+	Height int
+	// PWMBits is the number of bit planes displayed per row.
+	PWMBits int
+}
+
+// Decode rebuilds the image shown by the panels from the trace. Each OE pulse
+// displays the data latched last on the row addressed by that latch. The
+// pulses following a row address change are the bit planes of that row,
+// least significant first. Each plane weighs the length of its pulse on the
+// board clock, so that pixels are the fraction of the row time their LEDs
+// are lit, scaled to 0..255, the last frame in the trace winning.
+func Decode(tr fake.Trace, cfg *Config) (*image.RGBA, error) {
+	pins := cfg.Pins
+	var dataPins []int
+	for _, c := range pins.Colors {
+		dataPins = append(dataPins, c[:]...)
+	}
+	if len(dataPins) > 32 {
+		return nil, fmt.Errorf("hub75: too many color pins %d", len(dataPins))
+	}
+	clocks := tr.Clocks(pins.Clock, dataPins)
+	latches := tr.Latches(pins.Strobe, pins.Address)
+	pulses := tr.Pulses(pins.OutputEnable, false)
+
+	dRows := cfg.Height / 2
+	planes := make([][][]uint32, dRows)
+	lengths := make([][]time.Duration, dRows)
+	for i := range planes {
+		planes[i] = make([][]uint32, cfg.PWMBits)
+		lengths[i] = make([]time.Duration, cfg.PWMBits)
+	}
+
+	type latched struct {
+		seq  int
+		addr int
+		data []uint32
+	}
+	var ls []latched
+	ci := 0
+	for i, l := range latches {
+		start := ci
+		for ci < len(clocks) && clocks[ci].Seq < l.Seq {
+			ci++
+		}
+		if n := ci - start; n < cfg.Width {
+			// The trace may start in the middle of a row.
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("hub75: latch %d after %d clocks; want %d", l.Seq, n, cfg.Width)
+		}
+		if int(l.Bits) >= dRows {
+			return nil, fmt.Errorf("hub75: latch %d on row address %d out of %d", l.Seq, l.Bits, dRows)
+		}
+		data := make([]uint32, cfg.Width)
+		for x, s := range clocks[ci-cfg.Width : ci] {
+			data[x] = s.Bits
+		}
+		ls = append(ls, latched{seq: l.Seq, addr: int(l.Bits), data: data})
+	}
+
+	li := -1
+	prevAddr := -1
+	plane := 0
+	for _, p := range pulses {
+		if p.End == 0 {
+			// The trace may end in the middle of a pulse.
+			break
+		}
+		for li+1 < len(ls) && ls[li+1].seq < p.Start {
+			li++
+		}
+		if li < 0 {
+			continue
+		}
+		l := ls[li]
+		if l.addr != prevAddr {
+			plane = 0
+		} else {
+			plane = (plane + 1) % cfg.PWMBits
+		}
+		prevAddr = l.addr
+		planes[l.addr][plane] = l.data
+		lengths[l.addr][plane] = p.Duration
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, cfg.Width, cfg.Height*len(pins.Colors)))
+	for row, rowPlanes := range planes {
+		var total time.Duration
+		for plane, data := range rowPlanes {
+			if data == nil {
+				return nil, fmt.Errorf("hub75: row %d plane %d never displayed", row, plane)
+			}
+			total += lengths[row][plane]
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("hub75: row %d displayed for no time", row)
+		}
+		for x := 0; x < cfg.Width; x++ {
+			for chain := range pins.Colors {
+				for half := 0; half < 2; half++ {
+					var lit [3]time.Duration
+					for ch := range lit {
+						bit := uint(chain*6 + half*3 + ch)
+						for plane, data := range rowPlanes {
+							if data[x]&(1<<bit) != 0 {
+								lit[ch] += lengths[row][plane]
+							}
+						}
+					}
+					y := chain*cfg.Height + half*dRows + row
+					img.SetRGBA(x, y, color.RGBA{
+						R: uint8(lit[0] * 255 / total),
+						G: uint8(lit[1] * 255 / total),
+						B: uint8(lit[2] * 255 / total),
+						A: 255,
+					})
+				}
+			}
+		}
+	}
+	return img, nil
+}
@@ -2,176 +2,257 @@ package matrix
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/post-l/hw/board"
-	"github.com/post-l/hw/board/tinkerboard"
 )
 
 const pwmBitsLen = 11
 
-var vreal = []int{
-	53,    // 130
-	120,   // 260
-	250,   // 520
-	510,   // 1040
-	1000,  // 2080
-	2100,  // 4160
-	4800,  // 8320
-	10000, // 16640
-	30000, // 33280
-	60000, // 66560
-	37000, // 133120
+// ErrClosed is returned when rendering on a closed Matrix.
+var ErrClosed = errors.New("matrix: closed")
+
+// vreal holds, per bit plane, the length of its OE pulse, 130ns doubling
+// each plane, and the busy loop iterations holding it on a Raspberry Pi. The
+// last plane sleeps instead, loops being then the nanoseconds to sleep.
+var vreal = []struct {
+	d     time.Duration
+	loops int
+}{
+	{130, 53},
+	{260, 120},
+	{520, 250},
+	{1040, 510},
+	{2080, 1000},
+	{4160, 2100},
+	{8320, 4800},
+	{16640, 10000},
+	{33280, 30000},
+	{66560, 60000},
+	{133120, 37000},
 }
 
 type Matrix struct {
-	b  *tinkerboard.TinkerBoard
+	stats matrixStats
+
+	b  board.Board
 	hc *HardwareConfig
 
-	buf       []uint8
-	bbuf      []uint8
-	dRows     int
-	dRowAddrs []*tinkerboard.BankWriter
+	width   int
+	layout  *Layout
+	dRows   int
+	rowAddr rowAddresser
 
-	colorClkMask *tinkerboard.BankWriter
-	data         *tinkerboard.BankWriter
+	colorClkMask board.PinWriter
+	data         board.PinWriter
 
+	// pwmMu guards pwmStartBit and cie, changed by SetPWMBits while the
+	// scan and the frames read them.
+	pwmMu       sync.RWMutex
 	pwmStartBit int
+	cie         [256]uint16
+
+	// drawMu guards back, the frame drawn by Set and displayed by Render.
+	drawMu sync.Mutex
+	back   *Frame
 
-	cie [256]uint16
+	// mu guards pending, the frame to display next, free, the frames
+	// returned by NextFrame, and closed. swapped is signaled on swaps and
+	// on Close.
+	mu      sync.Mutex
+	swapped *sync.Cond
+	pending *Frame
+	free    []*Frame
+	closed  bool
 
-	swapc chan struct{}
+	// done is closed when run returns.
+	done chan struct{}
 
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
-func New(b board.Board, hc *HardwareConfig) *Matrix {
+// New returns a Matrix driving the panel described by hc through b and
+// starts refreshing it. It returns an error if hc is invalid or if the
+// mapping pins can't be set as outputs.
+func New(b board.Board, hc *HardwareConfig) (*Matrix, error) {
+	if err := hc.Validate(); err != nil {
+		return nil, err
+	}
+	layout, err := NewLayout(hc)
+	if err != nil {
+		return nil, err
+	}
 	hm := hc.Mapping
-	for _, pin := range hm.pins() {
-		b.SetPinMode(pin, board.Output)
+	if err := hm.validate(b, hc.Parallel); err != nil {
+		return nil, err
 	}
-
-	dRows := hc.Rows / 2
-	dRowAddrs := make([]*tinkerboard.BankWriter, dRows)
-	addrPins := []int{hm.a, hm.b, hm.c, hm.d, hm.e}
-	for i := uint32(0); i < uint32(dRows); i++ {
-		bw := tinkerboard.NewBankWriter(addrPins)
-		bw.Set(i)
-		dRowAddrs[i] = bw
+	for _, pin := range hm.pins(hc.Parallel) {
+		if err := b.SetPinMode(pin, board.Output); err != nil {
+			return nil, fmt.Errorf("matrix: invalid hardware mapping: %w", err)
+		}
 	}
 
+	cols, rows := hc.panelSize()
+	dRows := rows / 2
+
 	ctx, cancel := context.WithCancel(context.Background())
 
-	colorPins := []int{hm.r1, hm.g1, hm.b1, hm.r2, hm.g2, hm.b2, hm.clock}
-	bufSize := hc.PWMBits * hc.Cols * dRows
+	colorPins := append(hm.colorPins(hc.Parallel), hm.Clock)
+	width := cols * hc.ChainLength
 
 	m := &Matrix{
-		b:  b.(*tinkerboard.TinkerBoard),
+		b:  b,
 		hc: hc,
 
-		buf:       make([]uint8, bufSize),
-		bbuf:      make([]uint8, bufSize),
-		dRows:     dRows,
-		dRowAddrs: dRowAddrs,
+		width:   width,
+		layout:  layout,
+		dRows:   dRows,
+		rowAddr: newRowAddresser(b, &hm, hc.RowAddressType, dRows),
 
-		colorClkMask: tinkerboard.NewBankWriter(colorPins),
-		data:         tinkerboard.NewBankWriter(colorPins),
+		colorClkMask: board.NewPinWriter(b, colorPins),
+		data:         board.NewPinWriter(b, colorPins),
 
 		pwmStartBit: pwmBitsLen - hc.PWMBits,
 
-		swapc: make(chan struct{}),
-
 		ctx:    ctx,
 		cancel: cancel,
+		done:   make(chan struct{}),
 	}
+	m.swapped = sync.NewCond(&m.mu)
 	m.createLuminanceCIETable(hc.Brightness, hc.PWMBits)
-	go m.run()
-	return m
+	m.back = m.newFrame()
+	initPanel(b, &hm, hc.PanelType, hc.Parallel, width)
+	go m.run(m.newFrame())
+	return m, nil
 }
 
+// Close stops the refresh of the panels, waiting for the scan to end, and
+// blanks them, driving the output enable high and the data lines low. It
+// closes the board too if HardwareConfig.CloseBoard is set. Render and Swap
+// then return ErrClosed, as does Close.
 func (m *Matrix) Close() error {
+	m.mu.Lock()
+	closed := m.closed
+	m.closed = true
+	m.swapped.Broadcast()
+	m.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
 	m.cancel()
+	<-m.done
+
+	hm := m.hc.Mapping
+	m.b.DigitalWrite(hm.OutputEnable, true)
+	m.colorClkMask.Write()
+	m.b.DigitalWrite(hm.Strobe, false)
+	if m.hc.CloseBoard {
+		return m.b.Close()
+	}
 	return nil
 }
 
 // ColorModel returns the canvas' color model, always color.RGBAModel
 func (m *Matrix) ColorModel() color.Model { return color.RGBAModel }
 
-// Bounds return the topology of the Canvas
-func (m *Matrix) Bounds() image.Rectangle { return image.Rect(0, 0, m.hc.Cols, m.hc.Rows) }
+// Bounds return the topology of the Canvas, the chained panels side by side
+// and the parallel chains stacked, as arranged by the pixel mappers
+func (m *Matrix) Bounds() image.Rectangle { return m.layout.Bounds() }
 
-func (m *Matrix) At(x, y int) color.Color { return color.RGBA{} }
+// At returns the color last set at x, y on the back frame.
+func (m *Matrix) At(x, y int) color.Color {
+	m.drawMu.Lock()
+	defer m.drawMu.Unlock()
+	return m.back.At(x, y)
+}
 
+// Set sets the color at x, y on the back frame, displayed by Render. It is
+// safe to call from several goroutines.
 func (m *Matrix) Set(x, y int, c color.Color) {
-	var colorMask, roffset, goffset, boffset uint8
-	if y >= m.dRows {
-		colorMask = 7 // 0b000111
-		roffset, goffset, boffset = 8, 16, 32
-		y -= m.dRows
-	} else {
-		colorMask = 56 // 0b111000
-		roffset, goffset, boffset = 1, 2, 4
-	}
-	i := x + y*m.hc.Cols*m.hc.PWMBits
-	co := color.RGBAModel.Convert(c).(color.RGBA)
-	r := m.cie[co.R]
-	g := m.cie[co.G]
-	b := m.cie[co.B]
-	for bit := uint(0); bit < uint(m.hc.PWMBits); bit++ {
-		colorBits := m.bbuf[i] & colorMask
-		mask := uint16(1 << bit)
-		if r&mask != 0 {
-			colorBits |= roffset
-		}
-		if g&mask != 0 {
-			colorBits |= goffset
-		}
-		if b&mask != 0 {
-			colorBits |= boffset
-		}
-		m.bbuf[i] = colorBits
-		i += m.hc.Cols
-	}
+	m.drawMu.Lock()
+	m.back.Set(x, y, c)
+	m.drawMu.Unlock()
 }
 
-func (m *Matrix) PWMBits() int { return pwmBitsLen - m.pwmStartBit }
+func (m *Matrix) PWMBits() int {
+	m.pwmMu.RLock()
+	defer m.pwmMu.RUnlock()
+	return pwmBitsLen - m.pwmStartBit
+}
 
-// SetPWMBits sets PWM bits used for output. Default is 11, but if you only deal with
-// limited comic-colors, 1 might be sufficient. Lower require less CPU and
-// increases refresh-rate.
-func (m *Matrix) SetPWMBits(pwmBits int) {
+// SetPWMBits sets PWM bits used for output. If you only deal with limited
+// comic-colors, 1 might be sufficient. Lower require less CPU and increases
+// refresh-rate. Frames only hold HardwareConfig.PWMBits bit planes, so it
+// cannot be set above it. It is safe to call while rendering, but the pixels
+// set before it keep the bit planes of the former setting, and so display
+// wrong levels until set again: redraw the frames after changing it.
+func (m *Matrix) SetPWMBits(pwmBits int) error {
+	if pwmBits < 1 || pwmBits > m.hc.PWMBits {
+		return fmt.Errorf("matrix: invalid pwm bits %d, must be in 1..%d", pwmBits, m.hc.PWMBits)
+	}
+	m.pwmMu.Lock()
 	m.pwmStartBit = pwmBitsLen - pwmBits
 	m.createLuminanceCIETable(m.hc.Brightness, pwmBits)
+	m.pwmMu.Unlock()
+	return nil
 }
 
-// Render renders the back buffer. It waits to the next VSync and
-// swaps the active buffer with the back buffer one.
-func (m *Matrix) Render() {
-	m.swapc <- struct{}{}
+// Render displays the back frame, see Swap for the buffering modes. The new
+// back frame is a copy of the rendered one, so that drawing continues from
+// it.
+func (m *Matrix) Render() error {
+	m.drawMu.Lock()
+	defer m.drawMu.Unlock()
+	f, next := m.back, m.NextFrame()
+	next.copyFrom(f)
+	if err := m.Swap(f); err != nil {
+		m.release(next)
+		return err
+	}
+	m.back = next
+	return nil
 }
 
-func (m *Matrix) run() {
-	i := 0
-	var tc <-chan time.Time
-	if m.hc.ShowRefreshRate {
-		t := time.NewTicker(1 * time.Second)
-		defer t.Stop()
-		tc = t.C
+// TryRender is Render without waiting, see TrySwap. It reports whether the
+// back frame was queued, the back frame being unchanged otherwise.
+func (m *Matrix) TryRender() bool {
+	m.drawMu.Lock()
+	defer m.drawMu.Unlock()
+	f, next := m.back, m.NextFrame()
+	next.copyFrom(f)
+	if !m.TrySwap(f) {
+		m.release(next)
+		return false
 	}
+	m.back = next
+	return true
+}
+
+// run scans f, and the frames swapped after it, until the matrix is closed.
+// Every second, it updates the refresh rate and reports the stats.
+func (m *Matrix) run(f *Frame) {
+	defer close(m.done)
+	t := time.NewTicker(1 * time.Second)
+	defer t.Stop()
+	var lastFrames uint64
+	last := time.Now()
 	for {
-		m.render()
-		i++
+		m.render(f)
+		frames := atomic.AddUint64(&m.stats.frames, 1)
+		f = m.vsync(f)
 		select {
-		case <-m.swapc:
-			m.buf, m.bbuf = m.bbuf, m.buf
-		case <-tc:
-			fmt.Println(i, "fps")
-			i = 0
+		case now := <-t.C:
+			m.stats.setRefreshRate(float64(frames-lastFrames) / now.Sub(last).Seconds())
+			lastFrames, last = frames, now
+			m.reportStats()
 		case <-m.ctx.Done():
 			return
 		default:
@@ -179,10 +260,19 @@ func (m *Matrix) run() {
 	}
 }
 
-func (m *Matrix) render() {
+func (m *Matrix) reportStats() {
+	if m.hc.StatsFunc != nil {
+		m.hc.StatsFunc(m.Stats())
+	}
+}
+
+func (m *Matrix) render(f *Frame) {
 	hm := m.hc.Mapping
 	hdRows := m.dRows / 2
-	colSize := m.hc.Cols * m.hc.PWMBits
+	colSize := m.width * m.hc.PWMBits
+	m.pwmMu.RLock()
+	startBit := m.pwmStartBit
+	m.pwmMu.RUnlock()
 	for row := 0; row < m.dRows; row++ {
 		drow := row
 		if m.hc.ScanMode == Interlaced {
@@ -192,34 +282,43 @@ func (m *Matrix) render() {
 				drow = ((row - hdRows) << 1) + 1
 			}
 		}
-		drowAddr := m.dRowAddrs[drow]
-		m.b.PerfWrites(drowAddr)
+		start := time.Now()
+		m.rowAddr.setRow(drow)
 
 		i := drow * colSize
-		for x := m.pwmStartBit; x < pwmBitsLen; x++ {
-			for col := 0; col < m.hc.Cols; col++ {
-				v := uint32(m.buf[i])
-				m.data.Set(v)
-				m.b.PerfWrites(m.data)
-				m.b.DigitalWrite(hm.clock, true)
+		for x := startBit; x < pwmBitsLen; x++ {
+			for col := 0; col < m.width; col++ {
+				m.data.Set(f.buf[i])
+				m.data.Write()
+				m.b.DigitalWrite(hm.Clock, true)
 				i++
 			}
 
-			m.b.PerfWrites(m.colorClkMask)
+			m.colorClkMask.Write()
 
-			m.b.DigitalWrite(hm.strobe, true)
-			m.b.DigitalWrite(hm.strobe, false)
+			m.b.DigitalWrite(hm.Strobe, true)
+			m.b.DigitalWrite(hm.Strobe, false)
 
-			m.b.DigitalWrite(hm.outputEnable, false)
-			if x == pwmBitsLen-1 {
-				d := time.Duration(vreal[x])
-				time.Sleep(d)
-			} else {
-				for i := vreal[x]; i != 0; i-- {
-				}
-			}
-			m.b.DigitalWrite(hm.outputEnable, true)
+			m.b.DigitalWrite(hm.OutputEnable, false)
+			m.hold(x)
+			m.b.DigitalWrite(hm.OutputEnable, true)
 		}
+		m.stats.rowTime(time.Since(start))
+	}
+}
+
+// hold waits for the OE pulse of bit plane x, on the board clock if it has
+// one.
+func (m *Matrix) hold(x int) {
+	if s, ok := m.b.(board.Sleeper); ok {
+		s.Sleep(vreal[x].d)
+		return
+	}
+	if x == pwmBitsLen-1 {
+		time.Sleep(time.Duration(vreal[x].loops))
+		return
+	}
+	for i := vreal[x].loops; i != 0; i-- {
 	}
 }
 
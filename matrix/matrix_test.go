@@ -19,7 +19,10 @@ func TestMatrix(t *testing.T) {
 	if err != nil {
 		t.Fatal("board:", err)
 	}
-	m := matrix.New(b, &matrix.DefaultHardwareConfig)
+	m, err := matrix.New(b, &matrix.DefaultHardwareConfig)
+	if err != nil {
+		t.Fatal("matrix:", err)
+	}
 	defer m.Close()
 
 	// Red Matrix
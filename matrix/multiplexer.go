@@ -0,0 +1,179 @@
+package matrix
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Multiplexer maps the pixels of an outdoor panel scanning fewer rows than
+// its height allows, like a 1/4 or 1/8 scan one, to the pixels of the
+// panel as driven. Such a panel is driven as a StretchFactor times wider and
+// StretchFactor times lower one, like the multiplex mappers of
+// rpi-rgb-led-matrix.
+type Multiplexer interface {
+	// StretchFactor returns the factor the panel is stretched by.
+	StretchFactor() int
+	// MapPanel returns the coordinates, on the stretched panel, of the pixel
+	// x, y of a cols by rows panel.
+	MapPanel(cols, rows, x, y int) (int, int)
+}
+
+// MultiplexerValidator is implemented by multiplexers only mapping some panel
+// sizes.
+type MultiplexerValidator interface {
+	// Validate returns an error if a cols by rows panel can't be mapped.
+	Validate(cols, rows int) error
+}
+
+// StripeMultiplexer is the multiplexing of panels shifting each quarter of
+// their rows in stripes, the top stripe last.
+type StripeMultiplexer struct{}
+
+func (StripeMultiplexer) StretchFactor() int { return 2 }
+
+func (StripeMultiplexer) MapPanel(cols, rows, x, y int) (int, int) {
+	if isTopStripe(rows, y) {
+		x += cols
+	}
+	return x, stripeRow(rows, y)
+}
+
+// CheckeredMultiplexer is the multiplexing of panels shifting each quarter of
+// their rows in checkers of half their width.
+type CheckeredMultiplexer struct{}
+
+func (CheckeredMultiplexer) StretchFactor() int { return 2 }
+
+// Validate requires an even number of columns.
+func (CheckeredMultiplexer) Validate(cols, rows int) error {
+	return validateMultiplexedCols("checkered", cols, 2)
+}
+
+func (CheckeredMultiplexer) MapPanel(cols, rows, x, y int) (int, int) {
+	isLeft := x < cols/2
+	switch {
+	case isTopStripe(rows, y) && isLeft:
+		x += cols / 2
+	case isTopStripe(rows, y):
+		x += cols
+	case !isLeft:
+		x += cols / 2
+	}
+	return x, stripeRow(rows, y)
+}
+
+// SpiralMultiplexer is the multiplexing of panels shifting each quarter of
+// their rows in a spiral over quarters of their width.
+type SpiralMultiplexer struct{}
+
+func (SpiralMultiplexer) StretchFactor() int { return 2 }
+
+// Validate requires a multiple of 4 columns.
+func (SpiralMultiplexer) Validate(cols, rows int) error {
+	return validateMultiplexedCols("spiral", cols, 4)
+}
+
+func (SpiralMultiplexer) MapPanel(cols, rows, x, y int) (int, int) {
+	quarterCols := cols / 4
+	quarter, offset := x/quarterCols, x%quarterCols
+	x = 2 * quarter * quarterCols
+	if isTopStripe(rows, y) {
+		x += quarterCols - 1 - offset
+	} else {
+		x += quarterCols + offset
+	}
+	return x, stripeRow(rows, y)
+}
+
+// ZStripeMultiplexer is the multiplexing of panels shifting 8x4 tiles in a
+// Z, the tiles of even and odd blocks of 4 rows being shifted by EvenOffset
+// and OddOffset pixels.
+type ZStripeMultiplexer struct {
+	EvenOffset, OddOffset int
+}
+
+func (ZStripeMultiplexer) StretchFactor() int { return 2 }
+
+// Validate requires whole tiles, a multiple of 8 columns and of 8 rows.
+func (ZStripeMultiplexer) Validate(cols, rows int) error {
+	if rows%8 != 0 {
+		return fmt.Errorf("matrix: invalid rows %d, z-stripe multiplexing needs a multiple of 8", rows)
+	}
+	return validateMultiplexedCols("z-stripe", cols, 8)
+}
+
+func (z ZStripeMultiplexer) MapPanel(cols, rows, x, y int) (int, int) {
+	const tileWidth, tileHeight = 8, 4
+	evenShift, oddShift := z.EvenOffset, 0
+	if y/tileHeight%2 == 1 {
+		evenShift, oddShift = 0, z.OddOffset
+	}
+	x += (x+evenShift)/tileWidth*tileWidth + oddShift
+	return x, y%tileHeight + tileHeight*(y/(tileHeight*2))
+}
+
+func validateMultiplexedCols(name string, cols, n int) error {
+	if cols%n != 0 {
+		return fmt.Errorf("matrix: invalid cols %d, %s multiplexing needs a multiple of %d", cols, name, n)
+	}
+	return nil
+}
+
+// isTopStripe returns whether row y is in the top quarter of its half.
+func isTopStripe(rows, y int) bool { return y%(rows/2) < rows/4 }
+
+// stripeRow returns the stretched panel row of row y.
+func stripeRow(rows, y int) int { return y/(rows/2)*(rows/4) + y%(rows/4) }
+
+var multiplexers = map[string]Multiplexer{
+	"Stripe":          StripeMultiplexer{},
+	"Checkered":       CheckeredMultiplexer{},
+	"Spiral":          SpiralMultiplexer{},
+	"ZStripe":         ZStripeMultiplexer{EvenOffset: 0, OddOffset: 8},
+	"ZnMirrorZStripe": ZStripeMultiplexer{EvenOffset: 4, OddOffset: 4},
+}
+
+// NewMultiplexer returns the multiplexer registered as name, the names being
+// the rpi-rgb-led-matrix ones.
+func NewMultiplexer(name string) (Multiplexer, error) {
+	mux, ok := multiplexers[name]
+	if !ok {
+		return nil, fmt.Errorf("matrix: unknown multiplexer %q", name)
+	}
+	return mux, nil
+}
+
+// RegisterMultiplexer registers mux as name, replacing any multiplexer
+// already registered as name.
+func RegisterMultiplexer(name string, mux Multiplexer) {
+	multiplexers[name] = mux
+}
+
+// MultiplexerNames returns the registered multiplexer names, sorted.
+func MultiplexerNames() []string {
+	names := make([]string, 0, len(multiplexers))
+	for name := range multiplexers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// multiplexMapper is the PixelMapper applying a Multiplexer to each panel of
+// a canvas of stretched panels.
+type multiplexMapper struct {
+	mux        Multiplexer
+	cols, rows int
+}
+
+func (m multiplexMapper) Size(width, height int) (int, int, error) {
+	s := m.mux.StretchFactor()
+	return width / s, height * s, nil
+}
+
+func (m multiplexMapper) Map(width, height, x, y int) (int, int) {
+	s := m.mux.StretchFactor()
+	chained, parallel := x/m.cols, y/m.rows
+	x, y = m.mux.MapPanel(m.cols, m.rows, x%m.cols, y%m.rows)
+	return chained*m.cols*s + x, parallel*m.rows/s + y
+}
@@ -0,0 +1,120 @@
+package matrix_test
+
+import (
+	"image"
+	"testing"
+
+	"github.com/post-l/hw/matrix"
+)
+
+func TestMultiplexers(t *testing.T) {
+	const cols, rows = 32, 16
+	for _, name := range matrix.MultiplexerNames() {
+		mux, err := matrix.NewMultiplexer(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := mux.StretchFactor()
+		stretched := image.Rect(0, 0, cols*s, rows/s)
+		seen := make(map[image.Point]bool)
+		for y := 0; y < rows; y++ {
+			for x := 0; x < cols; x++ {
+				px, py := mux.MapPanel(cols, rows, x, y)
+				p := image.Pt(px, py)
+				if !p.In(stretched) || seen[p] {
+					t.Errorf("%s: invalid mapping of (%d, %d): %v", name, x, y, p)
+				}
+				seen[p] = true
+			}
+		}
+	}
+	if _, err := matrix.NewMultiplexer("unknown"); err == nil {
+		t.Error("expect NewMultiplexer to return an error for an unknown multiplexer")
+	}
+}
+
+func TestMultiplexerSizes(t *testing.T) {
+	// Any size passing Validate must map every pixel inside the stretched
+	// panel, once.
+	for _, name := range matrix.MultiplexerNames() {
+		mux, _ := matrix.NewMultiplexer(name)
+		s := mux.StretchFactor()
+		for rows := 4; rows <= 16; rows += 4 {
+			for cols := 1; cols <= 24; cols++ {
+				hc := matrix.DefaultHardwareConfig
+				hc.Rows, hc.Cols, hc.Multiplexer = rows, cols, mux
+				if hc.Validate() != nil {
+					continue
+				}
+				stretched := image.Rect(0, 0, cols*s, rows/s)
+				seen := make(map[image.Point]bool)
+				for y := 0; y < rows; y++ {
+					for x := 0; x < cols; x++ {
+						px, py := mux.MapPanel(cols, rows, x, y)
+						p := image.Pt(px, py)
+						if !p.In(stretched) || seen[p] {
+							t.Errorf("%s %dx%d: invalid mapping of (%d, %d): %v", name, cols, rows, x, y, p)
+						}
+						seen[p] = true
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMultiplexerValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		mux        matrix.Multiplexer
+		cols, rows int
+	}{
+		{"Checkered", matrix.CheckeredMultiplexer{}, 3, 16},
+		{"Spiral", matrix.SpiralMultiplexer{}, 2, 16},
+		{"Spiral", matrix.SpiralMultiplexer{}, 6, 16},
+		{"ZStripe", matrix.ZStripeMultiplexer{OddOffset: 8}, 4, 8},
+		{"ZStripe", matrix.ZStripeMultiplexer{OddOffset: 8}, 12, 8},
+		{"ZStripe", matrix.ZStripeMultiplexer{OddOffset: 8}, 8, 4},
+	}
+	for _, tc := range tests {
+		hc := matrix.DefaultHardwareConfig
+		hc.Rows, hc.Cols, hc.Multiplexer = tc.rows, tc.cols, tc.mux
+		if err := hc.Validate(); err == nil {
+			t.Errorf("%s %dx%d: got no error", tc.name, tc.cols, tc.rows)
+		}
+	}
+}
+
+func TestStripeMultiplexer(t *testing.T) {
+	tt := []struct{ x, y, wantX, wantY int }{
+		{0, 0, 32, 0},
+		{0, 3, 32, 3},
+		{0, 4, 0, 0},
+		{5, 8, 37, 4},
+		{31, 15, 31, 7},
+	}
+	for _, tc := range tt {
+		x, y := matrix.StripeMultiplexer{}.MapPanel(32, 16, tc.x, tc.y)
+		if x != tc.wantX || y != tc.wantY {
+			t.Errorf("invalid mapping of (%d, %d): got (%d, %d); want (%d, %d)", tc.x, tc.y, x, y, tc.wantX, tc.wantY)
+		}
+	}
+}
+
+func TestMultiplexerLayout(t *testing.T) {
+	hc := matrix.DefaultHardwareConfig
+	hc.Rows, hc.Cols, hc.ChainLength = 16, 32, 2
+	hc.Multiplexer = matrix.StripeMultiplexer{}
+	l, err := matrix.NewLayout(&hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := l.Bounds(), image.Rect(0, 0, 64, 16); got != want {
+		t.Errorf("invalid bounds: got %v; want %v", got, want)
+	}
+	// The second panel is shifted after the 64 pixels of the first one.
+	x, y := l.Map(32, 0)
+	if got, want := image.Pt(x, y), image.Pt(96, 0); got != want {
+		t.Errorf("invalid mapping: got %v; want %v", got, want)
+	}
+}
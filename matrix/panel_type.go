@@ -0,0 +1,96 @@
+package matrix
+
+import (
+	"fmt"
+
+	"github.com/post-l/hw/board"
+)
+
+// PanelType is the driver chip of panels needing an initialization before
+// they display anything.
+type PanelType string
+
+const (
+	// GenericPanel is a panel needing no initialization.
+	GenericPanel PanelType = ""
+	FM6126APanel PanelType = "FM6126A"
+	FM6127Panel  PanelType = "FM6127"
+)
+
+// panelRegister is a configuration register of the panel driver chips, its
+// bits being repeated over every column.
+type panelRegister struct {
+	bits string
+	// latch is the number of columns, minus one, the strobe is held high
+	// for at the end of the register, selecting it.
+	latch int
+}
+
+type panelInit struct {
+	registers []panelRegister
+	// addressA holds the A address line high during the initialization.
+	addressA bool
+}
+
+// panelInits holds the initializations of rpi-rgb-led-matrix.
+var panelInits = map[PanelType]panelInit{
+	FM6126APanel: {
+		registers: []panelRegister{
+			{"0111111111111111", 12}, // full brightness
+			{"0000000001000000", 13}, // panel on
+		},
+		addressA: true,
+	},
+	FM6127Panel: {
+		registers: []panelRegister{
+			{"1111111111001110", 12},
+			{"1110000001100010", 13},
+			{"0101111100000000", 11},
+		},
+	},
+}
+
+func (t PanelType) validate() error {
+	if _, ok := panelInits[t]; !ok && t != GenericPanel {
+		return fmt.Errorf("matrix: unknown panel type %q", string(t))
+	}
+	return nil
+}
+
+// initPanel writes the configuration registers of the panels of type t,
+// shifting columns pixels on the color pins of the parallel chains.
+func initPanel(b board.Board, hm *HardwareMapping, t PanelType, parallel, columns int) {
+	pi, ok := panelInits[t]
+	if !ok {
+		return
+	}
+	colorPins := hm.colorPins(parallel)
+	pins := append(colorPins, hm.Strobe)
+	strobe := uint32(1) << uint(len(colorPins))
+	on, off := strobe-1, uint32(0)
+	if pi.addressA {
+		pins = append(pins, hm.A)
+		a := strobe << 1
+		on, off = on|a, off|a
+	}
+
+	pw := board.NewPinWriter(b, pins)
+	b.DigitalWrite(hm.Clock, false)
+	b.DigitalWrite(hm.Strobe, false)
+	for _, reg := range pi.registers {
+		for i := 0; i < columns; i++ {
+			v := off
+			if reg.bits[i%len(reg.bits)] == '1' {
+				v = on
+			}
+			if i > columns-reg.latch {
+				v |= strobe
+			}
+			pw.Set(v)
+			pw.Write()
+			b.DigitalWrite(hm.Clock, true)
+			b.DigitalWrite(hm.Clock, false)
+		}
+		b.DigitalWrite(hm.Strobe, false)
+	}
+}
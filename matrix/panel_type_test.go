@@ -0,0 +1,78 @@
+package matrix
+
+import (
+	"testing"
+
+	"github.com/post-l/hw/board/fake"
+)
+
+func TestInitPanel(t *testing.T) {
+	const columns = 32
+	tt := []struct {
+		panelType PanelType
+		registers []panelRegister
+		addressA  bool
+	}{
+		{FM6126APanel, panelInits[FM6126APanel].registers, true},
+		{FM6127Panel, panelInits[FM6127Panel].registers, false},
+	}
+	for _, tc := range tt {
+		b := fake.New()
+		hm := DefaultHardwareMapping
+		initPanel(b, &hm, tc.panelType, 1, columns)
+		tr := b.Trace()
+		clocks := tr.Clocks(hm.Clock, []int{hm.R1, hm.B2, hm.Strobe, hm.A})
+		if got, want := len(clocks), columns*len(tc.registers); got != want {
+			t.Fatalf("%s: invalid clocks: got %d; want %d", tc.panelType, got, want)
+		}
+		for r, reg := range tc.registers {
+			for i := 0; i < columns; i++ {
+				s := clocks[r*columns+i]
+				on := reg.bits[i%16] == '1'
+				if got := s.Bits&1 != 0; got != on {
+					t.Errorf("%s: invalid register %d column %d r1: got %v; want %v", tc.panelType, r, i, got, on)
+				}
+				if got := s.Bits&2 != 0; got != on {
+					t.Errorf("%s: invalid register %d column %d b2: got %v; want %v", tc.panelType, r, i, got, on)
+				}
+				if got, want := s.Bits&4 != 0, i > columns-reg.latch; got != want {
+					t.Errorf("%s: invalid register %d column %d strobe: got %v; want %v", tc.panelType, r, i, got, want)
+				}
+				if got := s.Bits&8 != 0; got != tc.addressA {
+					t.Errorf("%s: invalid register %d column %d A: got %v; want %v", tc.panelType, r, i, got, tc.addressA)
+				}
+			}
+		}
+		if b.DigitalRead(hm.Strobe) {
+			t.Errorf("%s: expect the strobe to end low", tc.panelType)
+		}
+	}
+}
+
+func TestNewPanelType(t *testing.T) {
+	b := fake.New()
+	hc := testConfig(8, 16, 2, Progressive)
+	hc.PanelType = FM6126APanel
+	m, err := New(b, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	// Render never clocks with the strobe high, only the initialization
+	// does, before any frame is displayed.
+	hm := hc.Mapping
+	tr := b.Trace()
+	clocks := tr.Clocks(hm.Clock, []int{hm.Strobe})
+	latched := 0
+	for _, s := range clocks {
+		if s.Bits != 0 {
+			latched++
+		}
+	}
+	if got, want := latched, 11+12; got != want {
+		t.Errorf("invalid latched clocks: got %d; want %d", got, want)
+	}
+	if pulses := tr.Pulses(hm.OutputEnable, false); len(pulses) > 0 && pulses[0].Start < clocks[2*16-1].Seq {
+		t.Errorf("invalid first OE pulse %d before the end of the initialization %d", pulses[0].Start, clocks[2*16-1].Seq)
+	}
+}
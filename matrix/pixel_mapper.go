@@ -0,0 +1,248 @@
+package matrix
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PixelMapper maps the logical pixels of a canvas to the pixels of the canvas
+// beneath it, the panels or the previous mapper of the chain, like the pixel
+// mappers of rpi-rgb-led-matrix.
+type PixelMapper interface {
+	// Size returns the logical size of a canvas mapped over a width by
+	// height one, or an error if the mapper can't map such a canvas.
+	Size(width, height int) (int, int, error)
+	// Map returns the coordinates, in the width by height canvas beneath, of
+	// the logical pixel x, y.
+	Map(width, height, x, y int) (int, int)
+}
+
+// UMapper folds the chain in the middle, its second half forming a row of
+// panels below the first one, upside down, like a U. With parallel chains,
+// each chain is folded.
+type UMapper struct {
+	// Parallel is the number of parallel chains, zero meaning the Parallel
+	// of the HardwareConfig.
+	Parallel int
+}
+
+func (u UMapper) parallel() int {
+	if u.Parallel == 0 {
+		return 1
+	}
+	return u.Parallel
+}
+
+func (u UMapper) Size(width, height int) (int, int, error) {
+	if width%2 != 0 {
+		return 0, 0, fmt.Errorf("matrix: U-mapper: width %d can't be folded in half", width)
+	}
+	if height%u.parallel() != 0 {
+		return 0, 0, fmt.Errorf("matrix: U-mapper: height %d is not a multiple of %d chains", height, u.parallel())
+	}
+	return width / 2, height * 2, nil
+}
+
+func (u UMapper) Map(width, height, x, y int) (int, int) {
+	panelHeight := height / u.parallel()
+	slabHeight := 2 * panelHeight
+	baseY := y / slabHeight * panelHeight
+	y %= slabHeight
+	if y < panelHeight {
+		x += width / 2
+	} else {
+		x = width/2 - x - 1
+		y = slabHeight - y - 1
+	}
+	return x, baseY + y
+}
+
+func (u UMapper) String() string { return "U-mapper" }
+
+// RotateMapper rotates the canvas clockwise by Angle degrees, a multiple of
+// 90.
+type RotateMapper struct {
+	Angle int
+}
+
+func (r RotateMapper) angle() int { return (r.Angle%360 + 360) % 360 }
+
+func (r RotateMapper) Size(width, height int) (int, int, error) {
+	switch r.angle() {
+	case 0, 180:
+		return width, height, nil
+	case 90, 270:
+		return height, width, nil
+	}
+	return 0, 0, fmt.Errorf("matrix: Rotate: angle %d is not a multiple of 90", r.Angle)
+}
+
+func (r RotateMapper) Map(width, height, x, y int) (int, int) {
+	switch r.angle() {
+	case 90:
+		return width - y - 1, x
+	case 180:
+		return width - x - 1, height - y - 1
+	case 270:
+		return y, height - x - 1
+	}
+	return x, y
+}
+
+func (r RotateMapper) String() string { return "Rotate:" + strconv.Itoa(r.Angle) }
+
+// MirrorMapper mirrors the canvas horizontally, swapping left and right, or
+// vertically.
+type MirrorMapper struct {
+	Horizontal bool
+}
+
+func (m MirrorMapper) Size(width, height int) (int, int, error) {
+	return width, height, nil
+}
+
+func (m MirrorMapper) Map(width, height, x, y int) (int, int) {
+	if m.Horizontal {
+		return width - x - 1, y
+	}
+	return x, height - y - 1
+}
+
+func (m MirrorMapper) String() string {
+	if m.Horizontal {
+		return "Mirror:H"
+	}
+	return "Mirror:V"
+}
+
+var pixelMappers = map[string]func(param string) (PixelMapper, error){
+	"U-mapper": func(param string) (PixelMapper, error) {
+		if param != "" {
+			return nil, fmt.Errorf("unexpected parameter %q", param)
+		}
+		return UMapper{}, nil
+	},
+	"Rotate": func(param string) (PixelMapper, error) {
+		angle, err := strconv.Atoi(param)
+		if err != nil {
+			return nil, fmt.Errorf("invalid angle %q", param)
+		}
+		r := RotateMapper{Angle: angle}
+		if _, _, err := r.Size(0, 0); err != nil {
+			return nil, err
+		}
+		return r, nil
+	},
+	"Mirror": func(param string) (PixelMapper, error) {
+		switch strings.ToUpper(param) {
+		case "H":
+			return MirrorMapper{Horizontal: true}, nil
+		case "V":
+			return MirrorMapper{}, nil
+		}
+		return nil, fmt.Errorf("invalid direction %q, must be H or V", param)
+	},
+}
+
+// RegisterPixelMapper registers a pixel mapper as name, fn returning the
+// mapper for the parameter following the colon in a ParsePixelMappers
+// specification, if any. It replaces any mapper already registered as name.
+func RegisterPixelMapper(name string, fn func(param string) (PixelMapper, error)) {
+	pixelMappers[name] = fn
+}
+
+// PixelMapperNames returns the registered pixel mapper names, sorted.
+func PixelMapperNames() []string {
+	names := make([]string, 0, len(pixelMappers))
+	for name := range pixelMappers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePixelMappers parses a semicolon separated list of registered pixel
+// mappers, with an optional parameter after a colon, like
+// "U-mapper;Rotate:90".
+func ParsePixelMappers(spec string) ([]PixelMapper, error) {
+	var pms []PixelMapper
+	for _, s := range strings.Split(spec, ";") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		name, param := s, ""
+		if i := strings.IndexByte(s, ':'); i >= 0 {
+			name, param = s[:i], s[i+1:]
+		}
+		fn, ok := pixelMappers[name]
+		if !ok {
+			return nil, fmt.Errorf("matrix: unknown pixel mapper %q", name)
+		}
+		pm, err := fn(param)
+		if err != nil {
+			return nil, fmt.Errorf("matrix: pixel mapper %s: %v", name, err)
+		}
+		pms = append(pms, pm)
+	}
+	return pms, nil
+}
+
+// Layout maps the logical pixels of a HardwareConfig to the pixels of its
+// panels, through its pixel mappers and multiplexer.
+type Layout struct {
+	mappers []PixelMapper
+	// sizes holds the size of the canvas beneath each mapper, the panels
+	// first, and the logical size last.
+	sizes []image.Point
+}
+
+// NewLayout returns the layout of hc, or an error if one of its pixel mappers
+// can't map the canvas beneath it, like a U-mapper over an odd chain.
+func NewLayout(hc *HardwareConfig) (*Layout, error) {
+	cols, rows := hc.panelSize()
+	l := &Layout{
+		sizes: []image.Point{{cols * hc.ChainLength, rows * hc.Parallel}},
+	}
+	var mappers []PixelMapper
+	if hc.Multiplexer != nil {
+		mappers = append(mappers, multiplexMapper{mux: hc.Multiplexer, cols: hc.Cols, rows: hc.Rows})
+	}
+	for i, pm := range append(mappers, hc.PixelMappers...) {
+		if u, ok := pm.(UMapper); ok {
+			// Folding an odd chain would fold a panel in its middle.
+			if hc.ChainLength%2 != 0 {
+				return nil, fmt.Errorf("matrix: U-mapper: chain length %d can't be folded in half, must be even", hc.ChainLength)
+			}
+			if u.Parallel == 0 {
+				u.Parallel = hc.Parallel
+				pm = u
+			}
+		}
+		l.mappers = append(l.mappers, pm)
+		size := l.sizes[i]
+		w, h, err := pm.Size(size.X, size.Y)
+		if err != nil {
+			return nil, err
+		}
+		l.sizes = append(l.sizes, image.Pt(w, h))
+	}
+	return l, nil
+}
+
+// Bounds returns the logical bounds of the canvas.
+func (l *Layout) Bounds() image.Rectangle {
+	return image.Rectangle{Max: l.sizes[len(l.sizes)-1]}
+}
+
+// Map returns the coordinates on the panels of the logical pixel x, y, which
+// must be within the bounds.
+func (l *Layout) Map(x, y int) (int, int) {
+	for i := len(l.mappers) - 1; i >= 0; i-- {
+		x, y = l.mappers[i].Map(l.sizes[i].X, l.sizes[i].Y, x, y)
+	}
+	return x, y
+}
@@ -0,0 +1,117 @@
+package matrix_test
+
+import (
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/post-l/hw/matrix"
+)
+
+func TestPixelMappers(t *testing.T) {
+	tt := []struct {
+		name    string
+		mappers []matrix.PixelMapper
+		// physical holds the physical coordinates of the logical pixels
+		// (0, 0), (1, 0) and (0, 1).
+		physical   [3]image.Point
+		wantBounds image.Rectangle
+	}{
+		{"None", nil, [3]image.Point{{0, 0}, {1, 0}, {0, 1}}, image.Rect(0, 0, 8, 4)},
+		{"Rotate90", []matrix.PixelMapper{matrix.RotateMapper{Angle: 90}},
+			[3]image.Point{{7, 0}, {7, 1}, {6, 0}}, image.Rect(0, 0, 4, 8)},
+		{"Rotate180", []matrix.PixelMapper{matrix.RotateMapper{Angle: 180}},
+			[3]image.Point{{7, 3}, {6, 3}, {7, 2}}, image.Rect(0, 0, 8, 4)},
+		{"Rotate270", []matrix.PixelMapper{matrix.RotateMapper{Angle: -90}},
+			[3]image.Point{{0, 3}, {0, 2}, {1, 3}}, image.Rect(0, 0, 4, 8)},
+		{"MirrorH", []matrix.PixelMapper{matrix.MirrorMapper{Horizontal: true}},
+			[3]image.Point{{7, 0}, {6, 0}, {7, 1}}, image.Rect(0, 0, 8, 4)},
+		{"MirrorV", []matrix.PixelMapper{matrix.MirrorMapper{}},
+			[3]image.Point{{0, 3}, {1, 3}, {0, 2}}, image.Rect(0, 0, 8, 4)},
+		{"UMapper", []matrix.PixelMapper{matrix.UMapper{}},
+			[3]image.Point{{4, 0}, {5, 0}, {4, 1}}, image.Rect(0, 0, 4, 8)},
+		{"UMapperRotate90", []matrix.PixelMapper{matrix.UMapper{}, matrix.RotateMapper{Angle: 90}},
+			[3]image.Point{{7, 0}, {7, 1}, {6, 0}}, image.Rect(0, 0, 8, 4)},
+	}
+	for _, tc := range tt {
+		hc := testLayoutConfig(tc.mappers)
+		l, err := matrix.NewLayout(hc)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := l.Bounds(); got != tc.wantBounds {
+			t.Errorf("%s: invalid bounds: got %v; want %v", tc.name, got, tc.wantBounds)
+		}
+		for i, p := range []image.Point{{0, 0}, {1, 0}, {0, 1}} {
+			x, y := l.Map(p.X, p.Y)
+			if got, want := image.Pt(x, y), tc.physical[i]; got != want {
+				t.Errorf("%s: invalid mapping of %v: got %v; want %v", tc.name, p, got, want)
+			}
+		}
+		// Every physical pixel is mapped once.
+		seen := make(map[image.Point]bool)
+		b := l.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				px, py := l.Map(x, y)
+				p := image.Pt(px, py)
+				if !p.In(image.Rect(0, 0, 8, 4)) || seen[p] {
+					t.Errorf("%s: invalid mapping of (%d, %d): %v", tc.name, x, y, p)
+				}
+				seen[p] = true
+			}
+		}
+	}
+}
+
+func TestUMapperParallel(t *testing.T) {
+	hc := testLayoutConfig([]matrix.PixelMapper{matrix.UMapper{}})
+	hc.Rows, hc.Parallel = 2, 2
+	l, err := matrix.NewLayout(hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := l.Bounds(), image.Rect(0, 0, 4, 8); got != want {
+		t.Errorf("invalid bounds: got %v; want %v", got, want)
+	}
+	// The second chain starts on the second slab.
+	x, y := l.Map(0, 4)
+	if got, want := image.Pt(x, y), image.Pt(4, 2); got != want {
+		t.Errorf("invalid mapping: got %v; want %v", got, want)
+	}
+}
+
+func TestUMapperOddChain(t *testing.T) {
+	// Three 4 columns panels have an even width, but folding them would
+	// fold the second panel.
+	hc := testLayoutConfig([]matrix.PixelMapper{matrix.UMapper{}})
+	hc.ChainLength = 3
+	if _, err := matrix.NewLayout(hc); err == nil {
+		t.Error("expect NewLayout to return an error for an odd chain")
+	}
+}
+
+func TestParsePixelMappers(t *testing.T) {
+	got, err := matrix.ParsePixelMappers("U-mapper; Rotate:270;Mirror:v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []matrix.PixelMapper{matrix.UMapper{}, matrix.RotateMapper{Angle: 270}, matrix.MirrorMapper{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid pixel mappers: got %v; want %v", got, want)
+	}
+	for _, spec := range []string{"Unknown", "Rotate:45", "Rotate", "Mirror:X", "U-mapper:1"} {
+		if _, err := matrix.ParsePixelMappers(spec); err == nil {
+			t.Errorf("%s: got no error", spec)
+		}
+	}
+}
+
+// testLayoutConfig returns a config of 8x4 pixels, two 4x4 panels chained.
+func testLayoutConfig(mappers []matrix.PixelMapper) *matrix.HardwareConfig {
+	hc := matrix.DefaultHardwareConfig
+	hc.Rows, hc.Cols, hc.ChainLength = 4, 4, 2
+	hc.PixelMappers = mappers
+	return &hc
+}
@@ -0,0 +1,364 @@
+package matrix
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+
+	"github.com/post-l/hw/board/fake"
+	"github.com/post-l/hw/matrix/hub75"
+)
+
+// renderTrace draws img on m and returns a trace holding at least one full
+// frame of it.
+func renderTrace(m *Matrix, b *fake.Board, img image.Image) fake.Trace {
+	// Both buffers hold the image after the second swap, so the trace up to
+	// the third one holds at least one full frame of it.
+	draw.Draw(m, m.Bounds(), img, image.ZP, draw.Src)
+	m.Render()
+	draw.Draw(m, m.Bounds(), img, image.ZP, draw.Src)
+	b.Reset()
+	m.Render()
+	draw.Draw(m, m.Bounds(), img, image.ZP, draw.Src)
+	m.Render()
+	return b.Trace()
+}
+
+func testConfig(rows, cols, pwmBits int, scanMode ScanMode) *HardwareConfig {
+	hc := DefaultHardwareConfig
+	hc.Rows, hc.Cols, hc.PWMBits = rows, cols, pwmBits
+	hc.ScanMode = scanMode
+	return &hc
+}
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(255 * x / (w - 1)),
+				G: uint8(255 * y / (h - 1)),
+				B: uint8(255 * (x + y) / (w + h - 2)),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+func TestRender(t *testing.T) {
+	b := fake.New()
+	hc := testConfig(8, 4, 2, Progressive)
+	m, err := New(b, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	img := testImage(hc.Cols, hc.Rows)
+	tr := renderTrace(m, b, img)
+
+	hm := hc.Mapping
+	clocks := tr.Clocks(hm.Clock, []int{hm.R1, hm.G1, hm.B1, hm.R2, hm.G2, hm.B2})
+	latches := tr.Latches(hm.Strobe, []int{hm.A, hm.B, hm.C, hm.D, hm.E})
+	frameLen := m.dRows * hc.PWMBits
+	start := -1
+	for i := 1; i+frameLen <= len(latches); i++ {
+		if latches[i].Bits == 0 && latches[i-1].Bits != 0 {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		t.Fatalf("no full frame found in %d latches", len(latches))
+	}
+
+	ci := 0
+	for i, l := range latches[start : start+frameLen] {
+		row, plane := i/hc.PWMBits, uint(i%hc.PWMBits)
+		if got, want := l.Bits, uint32(row); got != want {
+			t.Fatalf("latch %d: invalid row address: got %d; want %d", i, got, want)
+		}
+		for clocks[ci].Seq < l.Seq {
+			ci++
+		}
+		shifted := clocks[ci-hc.Cols : ci]
+		for x, s := range shifted {
+			var want uint32
+			for half, y := range []int{row, row + m.dRows} {
+				c := img.RGBAAt(x, y)
+				for ch, v := range []uint8{c.R, c.G, c.B} {
+					if m.cie[v]>>plane&1 != 0 {
+						want |= 1 << uint(half*3+ch)
+					}
+				}
+			}
+			if got := s.Bits; got != want {
+				t.Errorf("row %d plane %d col %d: invalid color bits: got %06b; want %06b", row, plane, x, got, want)
+			}
+		}
+	}
+}
+
+func TestRenderPulses(t *testing.T) {
+	b := fake.New()
+	hc := testConfig(8, 4, pwmBitsLen, Progressive)
+	m, err := New(b, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	tr := renderTrace(m, b, testImage(hc.Cols, hc.Rows))
+	hm := hc.Mapping
+	latches := tr.Latches(hm.Strobe, []int{hm.A, hm.B, hm.C})
+	pulses := tr.Pulses(hm.OutputEnable, false)
+	start := 1
+	for start < len(latches) && latches[start].Bits == latches[start-1].Bits {
+		start++
+	}
+
+	// Binary coded modulation needs each plane to be displayed twice as
+	// long as the previous one.
+	n, pi := 0, 0
+	for i, l := range latches[start:] {
+		for pi < len(pulses) && pulses[pi].Start < l.Seq {
+			pi++
+		}
+		if pi == len(pulses) || pulses[pi].End == 0 {
+			break
+		}
+		plane := uint(i % hc.PWMBits)
+		if got, want := pulses[pi].Duration, 130*time.Nanosecond<<plane; got != want {
+			t.Errorf("plane %d: invalid OE pulse: got %v; want %v", plane, got, want)
+		}
+		n++
+	}
+	if got, want := n, m.dRows*hc.PWMBits; got < want {
+		t.Errorf("invalid number of pulses: got %d; want at least %d", got, want)
+	}
+}
+
+func TestRenderImage(t *testing.T) {
+	scanModes := []struct {
+		name string
+		mode ScanMode
+	}{
+		{"Progressive", Progressive},
+		{"Interlaced", Interlaced},
+	}
+	for _, sm := range scanModes {
+		for _, pwmBits := range []int{1, 3, 5, 11} {
+			scanMode := sm.mode
+			t.Run(fmt.Sprintf("%s/PWMBits%d", sm.name, pwmBits), func(t *testing.T) {
+				b := fake.New()
+				hc := testConfig(16, 8, pwmBits, scanMode)
+				m, err := New(b, hc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer m.Close()
+
+				img := testImage(hc.Cols, hc.Rows)
+				tr := renderTrace(m, b, img)
+				got, err := hub75.Decode(tr, decodeConfig(hc))
+				if err != nil {
+					t.Fatal("decode:", err)
+				}
+				maxLevel := (1 << uint(pwmBits)) - 1
+				level := func(v uint8) uint8 { return uint8(int(m.cie[v]) * 255 / maxLevel) }
+				for y := 0; y < hc.Rows; y++ {
+					for x := 0; x < hc.Cols; x++ {
+						c := img.RGBAAt(x, y)
+						want := color.RGBA{R: level(c.R), G: level(c.G), B: level(c.B), A: 255}
+						if got := got.RGBAAt(x, y); got != want {
+							t.Errorf("invalid pixel (%d, %d): got %v; want %v", x, y, got, want)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSetPWMBits(t *testing.T) {
+	b := fake.New()
+	hc := testConfig(8, 4, 2, Progressive)
+	m, err := New(b, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for _, pwmBits := range []int{0, 3, 5, pwmBitsLen} {
+		if err := m.SetPWMBits(pwmBits); err == nil {
+			t.Errorf("SetPWMBits(%d) succeeded; want error", pwmBits)
+		}
+	}
+	if got, want := m.PWMBits(), 2; got != want {
+		t.Errorf("invalid pwm bits after errors: got %d; want %d", got, want)
+	}
+	if err := m.SetPWMBits(1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.PWMBits(), 1; got != want {
+		t.Errorf("invalid pwm bits: got %d; want %d", got, want)
+	}
+
+	// The frames keep their planes, only the first one being displayed.
+	img := testImage(hc.Cols, hc.Rows)
+	cfg := decodeConfig(hc)
+	cfg.PWMBits = 1
+	got, err := hub75.Decode(renderTrace(m, b, img), cfg)
+	if err != nil {
+		t.Fatal("decode:", err)
+	}
+	level := func(v uint8) uint8 { return uint8(int(m.cie[v]) * 255) }
+	for y := 0; y < hc.Rows; y++ {
+		for x := 0; x < hc.Cols; x++ {
+			c := img.RGBAAt(x, y)
+			want := color.RGBA{R: level(c.R), G: level(c.G), B: level(c.B), A: 255}
+			if got := got.RGBAAt(x, y); got != want {
+				t.Errorf("invalid pixel (%d, %d): got %v; want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestSetPWMBitsWhileRendering(t *testing.T) {
+	hc := testConfig(8, 4, 3, Progressive)
+	m, err := New(fake.New(), hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			m.SetPWMBits(1 + i%hc.PWMBits)
+		}
+	}()
+	img := testImage(hc.Cols, hc.Rows)
+	for i := 0; i < 10; i++ {
+		f := m.NextFrame()
+		draw.Draw(f, f.Bounds(), img, image.ZP, draw.Src)
+		if err := m.Swap(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if got, want := m.PWMBits(), 1+99%hc.PWMBits; got != want {
+		t.Errorf("invalid pwm bits: got %d; want %d", got, want)
+	}
+}
+
+func TestRenderChain(t *testing.T) {
+	hc := testConfig(8, 4, 3, Interlaced)
+	hc.ChainLength = 3
+	testRenderLayout(t, hc, 12, 8)
+}
+
+func TestRenderMultiplexer(t *testing.T) {
+	hc := testConfig(16, 8, 2, Progressive)
+	hc.ChainLength = 2
+	hc.Multiplexer = StripeMultiplexer{}
+	testRenderLayout(t, hc, 16, 16)
+}
+
+func TestRenderParallel(t *testing.T) {
+	hc := testConfig(8, 4, 3, Progressive)
+	hc.ChainLength = 2
+	hc.Parallel = 3
+	hc.Mapping = RegularHardwareMapping
+	testRenderLayout(t, hc, 8, 24)
+}
+
+// testRenderLayout checks that hc renders a w by h image, the decoded
+// panels showing its pixels where the layout maps them.
+func testRenderLayout(t *testing.T, hc *HardwareConfig, w, h int) {
+	b := fake.New()
+	m, err := New(b, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if got, want := m.Bounds(), image.Rect(0, 0, w, h); got != want {
+		t.Errorf("invalid bounds: got %v; want %v", got, want)
+	}
+	img := testImage(w, h)
+	got, err := hub75.Decode(renderTrace(m, b, img), decodeConfig(hc))
+	if err != nil {
+		t.Fatal("decode:", err)
+	}
+	maxLevel := (1 << uint(hc.PWMBits)) - 1
+	level := func(v uint8) uint8 { return uint8(int(m.cie[v]) * 255 / maxLevel) }
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.RGBAAt(x, y)
+			want := color.RGBA{R: level(c.R), G: level(c.G), B: level(c.B), A: 255}
+			px, py := m.layout.Map(x, y)
+			if got := got.RGBAAt(px, py); got != want {
+				t.Errorf("invalid pixel (%d, %d) at (%d, %d): got %v; want %v", x, y, px, py, got, want)
+			}
+		}
+	}
+}
+
+func decodeConfig(hc *HardwareConfig) *hub75.Config {
+	hm := hc.Mapping
+	cols, rows := hc.panelSize()
+	pins := hm.colorPins(hc.Parallel)
+	colors := make([][6]int, hc.Parallel)
+	for i := range colors {
+		copy(colors[i][:], pins[i*6:])
+	}
+	return &hub75.Config{
+		Pins: hub75.Pins{
+			Clock:        hm.Clock,
+			Strobe:       hm.Strobe,
+			OutputEnable: hm.OutputEnable,
+			Address:      []int{hm.A, hm.B, hm.C, hm.D, hm.E},
+			Colors:       colors,
+		},
+		Width:   cols * hc.ChainLength,
+		Height:  rows,
+		PWMBits: hc.PWMBits,
+	}
+}
+
+func TestAt(t *testing.T) {
+	hc := testConfig(8, 4, 3, Progressive)
+	hc.ChainLength = 2
+	hc.PixelMappers = []PixelMapper{RotateMapper{Angle: 90}}
+	m, err := New(fake.New(), hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// Drawing over m reads it back, the result matching the same drawing
+	// on an RGBA image.
+	img := testImage(8, 8)
+	want := image.NewRGBA(img.Bounds())
+	half := image.NewUniform(color.RGBA{R: 128, A: 128})
+	for _, dst := range []draw.Image{m, want} {
+		draw.Draw(dst, dst.Bounds(), img, image.ZP, draw.Src)
+		draw.Draw(dst, image.Rect(2, 2, 6, 6), half, image.ZP, draw.Over)
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if got, want := m.At(x, y), want.RGBAAt(x, y); got != want {
+				t.Errorf("invalid pixel (%d, %d): got %v; want %v", x, y, got, want)
+			}
+		}
+	}
+	if got, want := m.At(8, 0), (color.RGBA{}); got != want {
+		t.Errorf("invalid pixel out of bounds: got %v; want %v", got, want)
+	}
+}
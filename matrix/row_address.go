@@ -0,0 +1,126 @@
+package matrix
+
+import (
+	"fmt"
+
+	"github.com/post-l/hw/board"
+)
+
+// RowAddressType is the way a panel selects the double row it displays.
+type RowAddressType int
+
+const (
+	// DirectRowAddress sets the double row index on the A to E lines, A
+	// being its lowest bit.
+	DirectRowAddress RowAddressType = iota
+	// ABCShiftRowAddress shifts one bit per double row into the row
+	// drivers, B being the clock, C the data and A the latch, as the ABC
+	// shift addressing of rpi-rgb-led-matrix. The selected double row is the
+	// low bit.
+	ABCShiftRowAddress
+	// DirectRowSelect drives one line per double row, A to E, the selected
+	// double row being low.
+	DirectRowSelect
+)
+
+var rowAddressTypeNames = map[RowAddressType]string{
+	DirectRowAddress:   "direct",
+	ABCShiftRowAddress: "abc-shift",
+	DirectRowSelect:    "direct-row-select",
+}
+
+func (t RowAddressType) String() string {
+	if name, ok := rowAddressTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("RowAddressType(%d)", int(t))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t RowAddressType) MarshalText() ([]byte, error) {
+	if _, ok := rowAddressTypeNames[t]; !ok {
+		return nil, fmt.Errorf("matrix: invalid row address type %d", int(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting "direct",
+// "abc-shift" and "direct-row-select".
+func (t *RowAddressType) UnmarshalText(text []byte) error {
+	for typ, name := range rowAddressTypeNames {
+		if string(text) == name {
+			*t = typ
+			return nil
+		}
+	}
+	return fmt.Errorf("matrix: invalid row address type %q", text)
+}
+
+// maxDRows returns the maximum number of double rows t can address, -1 for
+// no maximum and 0 if t is invalid.
+func (t RowAddressType) maxDRows() int {
+	switch t {
+	case DirectRowAddress:
+		return 1 << addrLinesLen
+	case ABCShiftRowAddress:
+		return -1
+	case DirectRowSelect:
+		return addrLinesLen
+	}
+	return 0
+}
+
+// rowAddresser selects the double row displayed by the panel.
+type rowAddresser interface {
+	setRow(row int)
+}
+
+func newRowAddresser(b board.Board, hm *HardwareMapping, t RowAddressType, dRows int) rowAddresser {
+	addrPins := []int{hm.A, hm.B, hm.C, hm.D, hm.E}
+	switch t {
+	case ABCShiftRowAddress:
+		return &shiftRowAddresser{b: b, clock: hm.B, data: hm.C, latch: hm.A, dRows: dRows, last: -1}
+	case DirectRowSelect:
+		all := uint32(1)<<uint(dRows) - 1
+		return newPinRowAddresser(b, addrPins, dRows, func(row int) uint32 { return all &^ (1 << uint(row)) })
+	}
+	return newPinRowAddresser(b, addrPins, dRows, func(row int) uint32 { return uint32(row) })
+}
+
+// pinRowAddresser writes a value per double row on the address pins.
+type pinRowAddresser []board.PinWriter
+
+func newPinRowAddresser(b board.Board, pins []int, dRows int, value func(row int) uint32) pinRowAddresser {
+	pa := make(pinRowAddresser, dRows)
+	for row := range pa {
+		pw := board.NewPinWriter(b, pins)
+		pw.Set(value(row))
+		pa[row] = pw
+	}
+	return pa
+}
+
+func (pa pinRowAddresser) setRow(row int) { pa[row].Write() }
+
+// shiftRowAddresser shifts the selected double row into the row drivers,
+// the last double row first.
+type shiftRowAddresser struct {
+	b                  board.Board
+	clock, data, latch int
+	dRows              int
+	last               int
+}
+
+func (sa *shiftRowAddresser) setRow(row int) {
+	if row == sa.last {
+		return
+	}
+	for i := sa.dRows - 1; i >= 0; i-- {
+		sa.b.DigitalWrite(sa.clock, false)
+		sa.b.DigitalWrite(sa.data, i != row)
+		sa.b.DigitalWrite(sa.clock, true)
+	}
+	sa.b.DigitalWrite(sa.latch, true)
+	sa.b.DigitalWrite(sa.latch, false)
+	sa.last = row
+}
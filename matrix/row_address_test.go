@@ -0,0 +1,53 @@
+package matrix
+
+import (
+	"testing"
+
+	"github.com/post-l/hw/board/fake"
+)
+
+func TestDirectRowSelect(t *testing.T) {
+	b := fake.New()
+	hm := DefaultHardwareMapping
+	ra := newRowAddresser(b, &hm, DirectRowSelect, 4)
+	addrPins := []int{hm.A, hm.B, hm.C, hm.D}
+	for row := 0; row < 4; row++ {
+		ra.setRow(row)
+		for i, pin := range addrPins {
+			if got, want := b.DigitalRead(pin), i != row; got != want {
+				t.Errorf("invalid row %d line %d: got %v; want %v", row, i, got, want)
+			}
+		}
+	}
+}
+
+func TestABCShiftRowAddress(t *testing.T) {
+	b := fake.New()
+	hm := DefaultHardwareMapping
+	const dRows = 6
+	ra := newRowAddresser(b, &hm, ABCShiftRowAddress, dRows)
+	for _, row := range []int{0, 4, 5} {
+		b.Reset()
+		ra.setRow(row)
+		tr := b.Trace()
+		bits := tr.Clocks(hm.B, []int{hm.C})
+		if len(bits) != dRows {
+			t.Fatalf("invalid row %d clocks: got %d; want %d", row, len(bits), dRows)
+		}
+		// The first bit shifted ends up in the last double row.
+		for i, s := range bits {
+			if got, want := s.Bits == 0, dRows-1-i == row; got != want {
+				t.Errorf("invalid row %d bit %d: got selected %v; want %v", row, i, got, want)
+			}
+		}
+		if got := tr.Latches(hm.A, nil); len(got) != 1 || got[0].Seq < bits[dRows-1].Seq {
+			t.Errorf("invalid row %d latches: %v", row, got)
+		}
+	}
+	// Selecting the same row again does nothing.
+	b.Reset()
+	ra.setRow(5)
+	if got := b.Trace(); len(got) != 0 {
+		t.Errorf("invalid trace: got %v; want none", got)
+	}
+}
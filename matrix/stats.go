@@ -0,0 +1,71 @@
+package matrix
+
+import (
+	"expvar"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the refresh statistics of a Matrix.
+type Stats struct {
+	// RefreshRate is the number of frames scanned per second, over the last
+	// second.
+	RefreshRate float64
+	// Frames is the number of frames scanned.
+	Frames uint64
+	// Swaps is the number of frames swapped in.
+	Swaps uint64
+	// DroppedSwaps is the number of frames dropped by TripleBuffering,
+	// replaced before being displayed.
+	DroppedSwaps uint64
+	// SwapLatency is the time the last swapped frame waited to be
+	// displayed.
+	SwapLatency time.Duration
+	// MaxRowTime is the longest time spent scanning a row.
+	MaxRowTime time.Duration
+}
+
+// matrixStats holds the counters of Stats, updated atomically. It must stay
+// the first field of Matrix, 64-bit atomic operations needing 64-bit aligned
+// words on 32-bit platforms.
+type matrixStats struct {
+	refreshRate  uint64 // math.Float64bits of Stats.RefreshRate
+	frames       uint64
+	swaps        uint64
+	droppedSwaps uint64
+	swapLatency  int64
+	maxRowTime   int64
+}
+
+// Stats returns the refresh statistics of m. It is safe to call from any
+// goroutine.
+func (m *Matrix) Stats() Stats {
+	s := &m.stats
+	return Stats{
+		RefreshRate:  math.Float64frombits(atomic.LoadUint64(&s.refreshRate)),
+		Frames:       atomic.LoadUint64(&s.frames),
+		Swaps:        atomic.LoadUint64(&s.swaps),
+		DroppedSwaps: atomic.LoadUint64(&s.droppedSwaps),
+		SwapLatency:  time.Duration(atomic.LoadInt64(&s.swapLatency)),
+		MaxRowTime:   time.Duration(atomic.LoadInt64(&s.maxRowTime)),
+	}
+}
+
+// Publish publishes the Stats of m as the expvar name. Like expvar.Publish,
+// it panics if name is already published.
+func (m *Matrix) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return m.Stats() }))
+}
+
+func (s *matrixStats) setRefreshRate(rate float64) {
+	atomic.StoreUint64(&s.refreshRate, math.Float64bits(rate))
+}
+
+// rowTime records the scan of a row lasting d. Only the scan goroutine
+// writes maxRowTime.
+func (s *matrixStats) rowTime(d time.Duration) {
+	if int64(d) > atomic.LoadInt64(&s.maxRowTime) {
+		atomic.StoreInt64(&s.maxRowTime, int64(d))
+	}
+}
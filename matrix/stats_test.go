@@ -0,0 +1,77 @@
+package matrix
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/post-l/hw/board/fake"
+)
+
+func TestStats(t *testing.T) {
+	statsc := make(chan Stats, 1)
+	hc := testConfig(8, 4, 2, Progressive)
+	hc.Buffering = TripleBuffering
+	hc.StatsFunc = func(s Stats) {
+		select {
+		case statsc <- s:
+		default:
+		}
+	}
+	m, err := New(fake.New(), hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	const renders = 100
+	for i := 0; i < renders; i++ {
+		m.Set(0, 0, solidColor(i))
+		if err := m.Render(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var s Stats
+	select {
+	case s = <-statsc:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expect StatsFunc to be called every second")
+	}
+	if got, want := s.Swaps+s.DroppedSwaps, uint64(renders); got != want {
+		t.Errorf("invalid swaps and dropped swaps: got %d + %d; want %d", s.Swaps, s.DroppedSwaps, want)
+	}
+	if s.Frames == 0 || s.RefreshRate <= 0 || s.MaxRowTime <= 0 || s.SwapLatency <= 0 {
+		t.Errorf("invalid stats: %+v", s)
+	}
+	if got := m.Stats(); got.Frames < s.Frames {
+		t.Errorf("invalid frames: got %d; want at least %d", got.Frames, s.Frames)
+	}
+}
+
+// publishes numbers the expvar names published by TestPublish, expvar
+// panicking on names published twice when the tests are run again.
+var publishes int
+
+func TestPublish(t *testing.T) {
+	m, err := New(fake.New(), testConfig(8, 4, 2, Progressive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Render(); err != nil {
+		t.Fatal(err)
+	}
+
+	publishes++
+	name := fmt.Sprintf("matrix-test-%d", publishes)
+	m.Publish(name)
+	var got Stats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Frames == 0 || got.Swaps == 0 {
+		t.Errorf("invalid published stats: %+v", got)
+	}
+}
@@ -26,7 +26,7 @@ type Frame struct {
 // Matrix is an interface that represent any RGB matrix, very useful for testing.
 type Matrix interface {
 	draw.Image
-	Render()
+	Render() error
 }
 
 // ToolKit is a convinient set of function to operate with a led of Matrix.
@@ -42,9 +42,9 @@ func New(m Matrix) *ToolKit {
 }
 
 // DrawImage draws the given image.
-func (tk *ToolKit) DrawImage(img image.Image) {
+func (tk *ToolKit) DrawImage(img image.Image) error {
 	draw.Draw(tk.m, tk.m.Bounds(), img, image.ZP, draw.Src)
-	tk.m.Render()
+	return tk.m.Render()
 }
 
 // PlayAnimation play the image during the delay returned by Next, until an err
@@ -64,7 +64,9 @@ func (tk *ToolKit) PlayAnimation(ctx context.Context, a Animation) error {
 			}
 		}
 		img := a.Image()
-		tk.DrawImage(img)
+		if err := tk.DrawImage(img); err != nil {
+			return err
+		}
 		dt = dt % delay
 		d := delay - dt
 		select {
@@ -84,7 +86,9 @@ func (tk *ToolKit) PlayFrames(ctx context.Context, frames []Frame, loopCount int
 	loop := 0
 	for {
 		f := frames[i]
-		tk.DrawImage(f.Image)
+		if err := tk.DrawImage(f.Image); err != nil {
+			return err
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()